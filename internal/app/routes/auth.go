@@ -1,8 +1,7 @@
 package routes
 
 import (
-	"encoding/json"
-	"log"
+	"time"
 
 	"musick-server/internal/app/services"
 
@@ -13,52 +12,94 @@ type LoginRequest struct {
 	Token string `json:"token"` // JWT from Supabase
 }
 
+func (r *LoginRequest) Validate() error {
+	if r.Token == "" {
+		return invalidField("token", "token is required")
+	}
+	return nil
+}
+
 type LoginResponse struct {
-	Success  bool   `json:"success"`
-	Message  string `json:"message"`
-	UserID   string `json:"user_id,omitempty"`
-	UserName string `json:"user_name,omitempty"`
+	UserID    string `json:"user_id,omitempty"`
+	UserName  string `json:"user_name,omitempty"`
+	ExpiresAt string `json:"expires_at,omitempty"`
 }
 
 func RegisterAuthRoutes(s *easytcp.Server) {
-	s.AddRoute(10, handleLogin)
+	handle(s, 10, Public, handleLogin)
+	handle(s, 11, Public, handleRefreshToken)
 }
 
-func handleLogin(ctx easytcp.Context) {
-	req := ctx.Request()
-
-	var loginReq LoginRequest
-	if err := json.Unmarshal(req.Data(), &loginReq); err != nil {
-		sendError(ctx, "invalid request format")
-		return
+func handleLogin(c *Call, req *LoginRequest) (interface{}, error) {
+	// Clients that said hello with an unsupported version may not log in.
+	if info := services.GetClientInfo(c.Session()); info != nil && info.Refused {
+		return nil, fail(services.CodeUpgradeRequired, "client version too old, please update the app", nil).
+			WithDetails(map[string]interface{}{"min_client_version": services.MinClientVersion()})
 	}
 
 	// Verify token with Supabase
-	user, err := services.VerifyToken(loginReq.Token)
+	user, err := services.VerifyToken(c, req.Token)
 	if err != nil {
-		log.Printf("token verification failed: %v", err)
-		sendError(ctx, "authentication failed")
-		return
+		return nil, fail(services.CodeAuthFailed, "authentication failed", err)
 	}
 
-	log.Printf("user authenticated: %s (%s)", user.Email, user.ID)
+	services.Logf(c, "user authenticated: %s (%s)", user.Email, user.ID)
+
+	// The profile name wins over the token's once the user has edited it (route 502).
+	userName, err := services.RememberProfile(c, user.ID, user.GetUserName())
+	if err != nil {
+		services.Logf(c, "failed to record profile for %s: %v", user.ID, err)
+	}
+
+	// Logging in as someone else on the same connection must not inherit the previous
+	// user's room subscriptions, typing indicators or presence.
+	if prev := services.GetSession(c.Session()); prev != nil && prev.UserID != user.ID {
+		services.Logf(c, "session switched user: %s -> %s", prev.UserID, user.ID)
+		services.ClearTypingForSession(c.Session())
+		services.PresenceDisconnect(c.Session())
+		services.RemoveSessionFromAllRooms(c.Session())
+	}
 
 	// Store session data for the connection's lifetime
-	services.StoreSession(ctx.Session(), user.ID, user.Email, user.GetUserName())
+	services.StoreSession(c.Session(), user.ID, user.Email, userName, user.ExpiresAt)
+	services.PresenceConnect(c.Session(), user.ID)
 
-	resp := LoginResponse{
-		Success:  true,
-		Message:  "authenticated",
-		UserID:   user.ID,
-		UserName: user.GetUserName(),
+	return LoginResponse{
+		UserID:    user.ID,
+		UserName:  userName,
+		ExpiresAt: formatExpiry(user.ExpiresAt),
+	}, nil
+}
+
+// handleRefreshToken re-authenticates an existing session with a fresh token for the same user,
+// e.g. after an auth-expired push. The connection and room subscriptions are kept.
+func handleRefreshToken(c *Call, req *LoginRequest) (interface{}, error) {
+	if services.GetSession(c.Session()) == nil {
+		return nil, fail(services.CodeUnauthenticated, "no session to refresh, login first", nil)
+	}
+
+	user, err := services.VerifyToken(c, req.Token)
+	if err != nil {
+		return nil, fail(services.CodeAuthFailed, "authentication failed", err)
 	}
 
-	respData, _ := json.Marshal(resp)
-	ctx.SetResponseMessage(easytcp.NewMessage(req.ID(), respData))
+	userName := services.DisplayName(c, user.ID, user.GetUserName())
+	if !services.RefreshSession(c.Session(), user.ID, user.Email, userName, user.ExpiresAt) {
+		return nil, fail(services.CodeForbidden, "token belongs to a different user", nil)
+	}
+
+	services.Logf(c, "session refreshed: %s (%s)", user.Email, user.ID)
+
+	return LoginResponse{
+		UserID:    user.ID,
+		UserName:  userName,
+		ExpiresAt: formatExpiry(user.ExpiresAt),
+	}, nil
 }
 
-func sendError(ctx easytcp.Context, msg string) {
-	resp := LoginResponse{Success: false, Message: msg}
-	data, _ := json.Marshal(resp)
-	ctx.SetResponseMessage(easytcp.NewMessage(ctx.Request().ID(), data))
+func formatExpiry(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
 }
@@ -0,0 +1,119 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+
+	"musick-server/internal/app/services"
+
+	"github.com/DarthPestilane/easytcp"
+)
+
+// Call is passed to typed handlers: the route context plus the caller's session.
+// It satisfies context.Context, so it can be handed straight to services.
+type Call struct {
+	easytcp.Context
+	// User is the authenticated caller; nil only on Public routes called before login.
+	User *services.UserSession
+}
+
+// Validator is implemented by request types that check their own fields.
+// Return invalidField(...) to report the offending field; any other error's text
+// is sent as a VALIDATION_FAILED message.
+type Validator interface {
+	Validate() error
+}
+
+// RouteError carries an error code, a client-safe message, optional details and
+// the internal cause to log (never sent to the client).
+type RouteError struct {
+	Code    services.ErrorCode
+	Message string
+	Details map[string]interface{}
+	Err     error
+}
+
+func (e *RouteError) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *RouteError) Unwrap() error { return e.Err }
+
+// fail builds a RouteError; cause may be nil.
+func fail(code services.ErrorCode, message string, cause error) *RouteError {
+	return &RouteError{Code: code, Message: message, Err: cause}
+}
+
+// WithDetails attaches machine-readable context (e.g. the offending field) to the error.
+func (e *RouteError) WithDetails(details map[string]interface{}) *RouteError {
+	e.Details = details
+	return e
+}
+
+// invalidField reports a validation failure on a single request field.
+func invalidField(field, message string) *RouteError {
+	return fail(services.CodeValidationFailed, message, nil).WithDetails(map[string]interface{}{"field": field})
+}
+
+// storeFailure maps a storage error to NOT_FOUND (using notFoundMsg) or INTERNAL_ERROR (using msg).
+func storeFailure(err error, msg, notFoundMsg string) *RouteError {
+	if errors.Is(err, services.ErrNotFound) {
+		return fail(services.CodeNotFound, notFoundMsg, nil)
+	}
+	return fail(services.CodeInternal, msg, err)
+}
+
+// handle registers a typed route: the body is decoded into T, validated, and fn is
+// called with the caller's session. fn returns the response value or an error.
+func handle[T any](s *easytcp.Server, id int, access Access, fn func(c *Call, req *T) (interface{}, error)) {
+	setRouteAccess(id, access)
+	s.AddRoute(id, func(ctx easytcp.Context) {
+		req := new(T)
+		if data := ctx.Request().Data(); len(data) > 0 {
+			if err := json.Unmarshal(data, req); err != nil {
+				respond(ctx, services.Failure(services.CodeInvalidRequest, "invalid request format", nil))
+				return
+			}
+		}
+		if v, ok := any(req).(Validator); ok {
+			if err := v.Validate(); err != nil {
+				var re *RouteError
+				if !errors.As(err, &re) {
+					re = fail(services.CodeValidationFailed, err.Error(), nil)
+				}
+				respond(ctx, services.Failure(re.Code, re.Message, re.Details))
+				return
+			}
+		}
+
+		resp, err := fn(&Call{Context: ctx, User: sessionFromContext(ctx)}, req)
+		if err != nil {
+			sendRouteError(ctx, err)
+			return
+		}
+		respond(ctx, services.Success(resp))
+	})
+}
+
+// sendRouteError logs err's cause and responds with its code and message.
+// Errors that are not RouteErrors become INTERNAL_ERROR so internals never leak.
+func sendRouteError(ctx easytcp.Context, err error) {
+	var re *RouteError
+	if !errors.As(err, &re) {
+		re = fail(services.CodeInternal, "internal error", err)
+	}
+	if re.Err != nil {
+		services.Logf(ctx, "route %v: %s: %v", ctx.Request().ID(), re.Message, re.Err)
+	}
+	respond(ctx, services.Failure(re.Code, re.Message, re.Details))
+}
+
+// respond sets env as the response to the current request, echoing its correlation ID.
+func respond(ctx easytcp.Context, env services.Envelope) {
+	env.RequestID = services.RequestID(ctx)
+	id, _ := ctx.Request().ID().(int)
+	ctx.SetResponseMessage(services.NewEnvelopeMessage(id, env))
+}
@@ -0,0 +1,64 @@
+package routes
+
+import (
+	"musick-server/internal/app/services"
+
+	"github.com/DarthPestilane/easytcp"
+)
+
+type HelloRequest struct {
+	AppVersion string   `json:"app_version"`
+	Platform   string   `json:"platform,omitempty"`
+	Features   []string `json:"features"`
+}
+
+func (r *HelloRequest) Validate() error {
+	if r.AppVersion == "" {
+		return invalidField("app_version", "app_version is required")
+	}
+	return nil
+}
+
+type HelloResponse struct {
+	ProtocolVersion  int                        `json:"protocol_version"`
+	MinClientVersion string                     `json:"min_client_version,omitempty"`
+	ServerFeatures   []string                   `json:"server_features"`
+	Features         []string                   `json:"features"` // negotiated subset of the client's features
+	Limits           services.Limits            `json:"limits"`
+	DeprecatedRoutes []services.DeprecatedRoute `json:"deprecated_routes"`
+}
+
+// RegisterHelloRoutes wires the pre-login handshake.
+func RegisterHelloRoutes(s *easytcp.Server) {
+	handle(s, 2, Public, handleHello)
+}
+
+// handleHello exchanges versions and capabilities. Clients below MIN_CLIENT_VERSION
+// get UPGRADE_REQUIRED and are refused at login as well.
+func handleHello(c *Call, req *HelloRequest) (interface{}, error) {
+	minVersion := services.MinClientVersion()
+	info := &services.ClientInfo{
+		AppVersion: req.AppVersion,
+		Features:   services.NegotiateFeatures(req.Features),
+	}
+
+	if minVersion != "" && services.CompareVersions(req.AppVersion, minVersion) < 0 {
+		info.Refused = true
+		services.StoreClientInfo(c.Session(), info)
+		services.Logf(c, "hello refused: app_version=%s below minimum %s", req.AppVersion, minVersion)
+		return nil, fail(services.CodeUpgradeRequired, "client version too old, please update the app", nil).
+			WithDetails(map[string]interface{}{"min_client_version": minVersion, "app_version": req.AppVersion})
+	}
+
+	services.StoreClientInfo(c.Session(), info)
+	services.Logf(c, "hello: app_version=%s platform=%s features=%v", req.AppVersion, req.Platform, info.Features)
+
+	return HelloResponse{
+		ProtocolVersion:  services.ProtocolVersion,
+		MinClientVersion: minVersion,
+		ServerFeatures:   services.ServerFeatures,
+		Features:         info.Features,
+		Limits:           services.CurrentLimits(),
+		DeprecatedRoutes: services.DeprecatedRoutes,
+	}, nil
+}
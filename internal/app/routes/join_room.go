@@ -1,8 +1,7 @@
 package routes
 
 import (
-	"encoding/json"
-	"log"
+	"errors"
 	"time"
 
 	"musick-server/internal/app/services"
@@ -11,77 +10,61 @@ import (
 )
 
 type JoinRoomRequest struct {
-	Code   string `json:"code"`
-	UserID string `json:"user_id"`
+	Code string `json:"code"`
+}
+
+func (r *JoinRoomRequest) Validate() error {
+	if r.Code == "" {
+		return invalidField("code", "code is required")
+	}
+	return nil
 }
 
 type JoinRoomResponse struct {
-	Success   bool   `json:"success"`
-	Message   string `json:"message"`
 	RoomID    string `json:"room_id,omitempty"`
 	Code      string `json:"code,omitempty"`
 	Title     string `json:"title,omitempty"`
 	OwnerID   string `json:"owner_id,omitempty"`
 	IsPrivate bool   `json:"is_private,omitempty"`
 	CreatedAt string `json:"created_at,omitempty"`
+	// Seq and Epoch are the resume point for route 330, as on route 220.
+	Seq   int64  `json:"seq"`
+	Epoch string `json:"epoch,omitempty"`
 }
 
 func RegisterJoinRoomRoutes(s *easytcp.Server) {
-	s.AddRoute(202, handleJoinRoom)
+	handle(s, 202, Authenticated, handleJoinRoom)
 }
 
-func handleJoinRoom(ctx easytcp.Context) {
-	req := ctx.Request()
-
-	if !services.IsAuthenticated(ctx.Session()) {
-		sendJoinRoomError(ctx, "not authenticated")
-		return
+func handleJoinRoom(c *Call, req *JoinRoomRequest) (interface{}, error) {
+	room, joined, err := services.JoinRoomByCode(c, req.Code, c.User.UserID)
+	if errors.Is(err, services.ErrRoomArchived) {
+		return nil, fail(services.CodeForbidden, "room is archived", nil)
 	}
-
-	var jr JoinRoomRequest
-	if err := json.Unmarshal(req.Data(), &jr); err != nil {
-		sendJoinRoomError(ctx, "invalid request format")
-		return
-	}
-
-	if jr.Code == "" || jr.UserID == "" {
-		sendJoinRoomError(ctx, "code and user_id are required")
-		return
+	if errors.Is(err, services.ErrBanned) {
+		return nil, fail(services.CodeForbidden, "you are banned from this room", nil)
 	}
-
-	session := services.GetSession(ctx.Session())
-	if session == nil || session.UserID != jr.UserID {
-		sendJoinRoomError(ctx, "user_id mismatch")
-		return
+	if err != nil {
+		return nil, storeFailure(err, "failed to join room", "room not found")
 	}
 
-	room, err := services.JoinRoomByCode(jr.Code, jr.UserID)
-	if err != nil {
-		log.Printf("failed to join room: %v", err)
-		sendJoinRoomError(ctx, "failed to join room")
-		return
+	// Existing members rejoining (e.g. from another device) are not announced.
+	if joined {
+		services.BroadcastRoomEvent(room.ID, services.EventMemberJoined, c.User.UserID,
+			map[string]string{"user_name": c.User.UserName})
 	}
 
 	// Track membership for broadcasts
-	services.AddSessionToRoom(room.ID, ctx.Session())
+	seq := services.SubscribeRoom(room.ID, c.Session())
 
-	resp := JoinRoomResponse{
-		Success:   true,
-		Message:   "joined room",
+	return JoinRoomResponse{
 		RoomID:    room.ID,
 		Code:      room.Code,
 		Title:     room.Title,
 		OwnerID:   room.OwnerID,
 		IsPrivate: room.IsPrivate,
 		CreatedAt: room.CreatedAt.Format(time.RFC3339),
-	}
-
-	data, _ := json.Marshal(resp)
-	ctx.SetResponseMessage(easytcp.NewMessage(req.ID(), data))
-}
-
-func sendJoinRoomError(ctx easytcp.Context, msg string) {
-	resp := JoinRoomResponse{Success: false, Message: msg}
-	data, _ := json.Marshal(resp)
-	ctx.SetResponseMessage(easytcp.NewMessage(ctx.Request().ID(), data))
+		Seq:       seq,
+		Epoch:     services.ServerEpoch(),
+	}, nil
 }
@@ -0,0 +1,58 @@
+package routes
+
+import (
+	"musick-server/internal/app/services"
+
+	"github.com/DarthPestilane/easytcp"
+)
+
+type LeaveRoomRequest struct {
+	RoomID string `json:"room_id"`
+}
+
+func (r *LeaveRoomRequest) Validate() error {
+	if r.RoomID == "" {
+		return invalidField("room_id", "room_id is required")
+	}
+	return nil
+}
+
+type LeaveRoomResponse struct {
+	RoomID     string `json:"room_id"`
+	NewOwnerID string `json:"new_owner_id,omitempty"`
+	Archived   bool   `json:"archived,omitempty"`
+}
+
+func RegisterLeaveRoomRoutes(s *easytcp.Server) {
+	handle(s, 203, Authenticated, handleLeaveRoom)
+}
+
+func handleLeaveRoom(c *Call, req *LeaveRoomRequest) (interface{}, error) {
+	res, err := services.LeaveRoom(c, req.RoomID, c.User.UserID)
+	if res == nil {
+		return nil, storeFailure(err, "failed to leave room", "not a member of this room")
+	}
+	if err != nil {
+		// The membership is gone; only the ownership hand-off failed. Still tell the room.
+		services.Logf(c, "203 leave room: room=%s user=%s: %v", req.RoomID, c.User.UserID, err)
+	}
+
+	// Stop pushes to every connection the user has open, then tell whoever is left.
+	services.ClearTyping(req.RoomID, c.User.UserID)
+	dropped := services.RemoveUserFromRoom(req.RoomID, c.User.UserID)
+	services.Logf(c, "203 leave room: room=%s user=%s sessions=%d new_owner=%s archived=%v",
+		req.RoomID, c.User.UserID, dropped, res.NewOwnerID, res.Archived)
+
+	services.BroadcastRoomEvent(req.RoomID, services.EventMemberLeft, c.User.UserID,
+		map[string]string{"user_name": c.User.UserName})
+	if res.NewOwnerID != "" {
+		services.BroadcastRoomEvent(req.RoomID, services.EventOwnerChanged, res.NewOwnerID,
+			map[string]string{"previous_owner_id": c.User.UserID})
+	}
+
+	return LeaveRoomResponse{
+		RoomID:     req.RoomID,
+		NewOwnerID: res.NewOwnerID,
+		Archived:   res.Archived,
+	}, nil
+}
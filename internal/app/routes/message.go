@@ -1,10 +1,11 @@
 package routes
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"strconv"
 	"time"
+	"unicode/utf8"
 
 	"musick-server/internal/app/services"
 
@@ -12,39 +13,127 @@ import (
 )
 
 type SendMessageRequest struct {
-	UserID string `json:"user_id"`
 	RoomID string `json:"room_id"`
 	Body   string `json:"body"`
+	// ReplyToID quotes a message; ThreadRootID posts into that message's thread.
+	ReplyToID    int64 `json:"reply_to_id"`
+	ThreadRootID int64 `json:"thread_root_id"`
+	// ClientMsgID makes retries safe: a repeat with the same ID returns the original message.
+	ClientMsgID string `json:"client_msg_id"`
+}
+
+func (r *SendMessageRequest) Validate() error {
+	if r.RoomID == "" {
+		return invalidField("room_id", "room_id is required")
+	}
+	// Same shape as request IDs: up to 64 printable ASCII characters.
+	if r.ClientMsgID != "" && !validRequestID(r.ClientMsgID) {
+		return invalidField("client_msg_id", "client_msg_id must be 1-64 printable ASCII characters")
+	}
+	if r.ReplyToID < 0 {
+		return invalidField("reply_to_id", "reply_to_id must be a message id")
+	}
+	if r.ThreadRootID < 0 {
+		return invalidField("thread_root_id", "thread_root_id must be a message id")
+	}
+	return validateBody(r.Body)
+}
+
+// validateBody checks a message body is present and within MAX_MESSAGE_LENGTH.
+func validateBody(body string) error {
+	if body == "" {
+		return invalidField("body", "body is required")
+	}
+	if max := services.CurrentLimits().MaxMessageLength; max > 0 && utf8.RuneCountInString(body) > max {
+		return invalidField("body", fmt.Sprintf("body exceeds %d characters", max))
+	}
+	return nil
 }
 
 type SendMessageResponse struct {
-	Success    bool   `json:"success"`
-	Message    string `json:"message"`
 	ID         int64  `json:"id,omitempty"`
 	RoomID     string `json:"room_id,omitempty"`
 	SenderID   string `json:"sender_id,omitempty"`
 	SenderName string `json:"sender_name,omitempty"`
 	Body       string `json:"body,omitempty"`
 	SentAt     string `json:"sent_at,omitempty"`
+
+	ReplyToID    int64                    `json:"reply_to_id,omitempty"`
+	ReplyTo      *services.MessagePreview `json:"reply_to,omitempty"`
+	ThreadRootID int64                    `json:"thread_root_id,omitempty"`
+	ClientMsgID  string                   `json:"client_msg_id,omitempty"`
 }
 
+// FetchMessagesRequest pages through a room's timeline. At most one of the cursors
+// may be set: before_id / before_created_at page backwards, after_id forwards, and
+// around_id centres the page on a message. With none, the latest page is returned.
 type FetchMessagesRequest struct {
-	RoomID        string `json:"room_id"`
-	BeforeID      string `json:"before_id"`
-	Limit         int    `json:"limit"`
-	UserID        string `json:"user_id"`
-	IncludeSystem bool   `json:"include_system"`
+	RoomID          string `json:"room_id"`
+	BeforeID        string `json:"before_id"`
+	AfterID         string `json:"after_id"`
+	AroundID        string `json:"around_id"`
+	BeforeCreatedAt string `json:"before_created_at"`
+	Limit           int    `json:"limit"`
+	IncludeSystem   bool   `json:"include_system"`
+}
+
+func (r *FetchMessagesRequest) Validate() error {
+	if r.RoomID == "" {
+		return invalidField("room_id", "room_id is required")
+	}
+	cursors := 0
+	for _, cur := range [...]struct{ field, value string }{
+		{"before_id", r.BeforeID}, {"after_id", r.AfterID}, {"around_id", r.AroundID},
+	} {
+		if cur.value == "" {
+			continue
+		}
+		cursors++
+		if _, ok := parseMessageID(cur.value); !ok {
+			return invalidField(cur.field, cur.field+" must be a message id")
+		}
+	}
+	if r.BeforeCreatedAt != "" {
+		cursors++
+		if _, err := time.Parse(time.RFC3339, r.BeforeCreatedAt); err != nil {
+			return invalidField("before_created_at", "before_created_at must be an RFC 3339 timestamp")
+		}
+	}
+	if cursors > 1 {
+		return fail(services.CodeValidationFailed, "only one of before_id, after_id, around_id and before_created_at may be set", nil)
+	}
+	return validatePageLimit(r.Limit)
 }
 
+// parseMessageID parses a string message ID cursor; "" yields 0, false.
+func parseMessageID(s string) (int64, bool) {
+	id, err := strconv.ParseInt(s, 10, 64)
+	return id, err == nil && id > 0
+}
+
+// validatePageLimit rejects negative page sizes; 0 selects the default and larger
+// values are capped by the service.
+func validatePageLimit(limit int) error {
+	if limit < 0 {
+		return invalidField("limit", "limit must not be negative")
+	}
+	return nil
+}
+
+// FetchMessagesResponse is a page of history, newest first. HasMore is kept for older
+// clients and equals HasMoreBefore.
 type FetchMessagesResponse struct {
-	Success             bool             `json:"success"`
-	Message             string           `json:"message"`
 	Messages            []FetchedMessage `json:"messages,omitempty"`
 	HasMore             bool             `json:"has_more"`
+	HasMoreBefore       bool             `json:"has_more_before"`
+	HasMoreAfter        bool             `json:"has_more_after"`
 	NextBeforeID        string           `json:"next_before_id,omitempty"`
 	NextBeforeCreatedAt string           `json:"next_before_created_at,omitempty"`
+	NextAfterID         string           `json:"next_after_id,omitempty"`
 }
 
+// FetchedMessage is a message in history and in edit/delete events. Deleted messages
+// are tombstones: Deleted is set and Body is empty.
 type FetchedMessage struct {
 	ID         int64  `json:"id"`
 	RoomID     string `json:"room_id"`
@@ -52,159 +141,371 @@ type FetchedMessage struct {
 	SenderName string `json:"sender_name,omitempty"`
 	Body       string `json:"body"`
 	CreatedAt  string `json:"created_at"`
+	Edited     bool   `json:"edited,omitempty"`
+	EditedAt   string `json:"edited_at,omitempty"`
+	Deleted    bool   `json:"deleted,omitempty"`
+	DeletedAt  string `json:"deleted_at,omitempty"`
+	// Reactions are filled in by routes 310/315 for the requesting user.
+	Reactions []services.ReactionSummary `json:"reactions,omitempty"`
+
+	ReplyToID    int64                    `json:"reply_to_id,omitempty"`
+	ReplyTo      *services.MessagePreview `json:"reply_to,omitempty"`
+	ThreadRootID int64                    `json:"thread_root_id,omitempty"`
+	// ReplyCount is the number of thread replies; set on thread roots.
+	ReplyCount int `json:"reply_count,omitempty"`
 }
 
-func RegisterMessageRoutes(s *easytcp.Server) {
-	s.AddRoute(301, handleSendMessage)
-	s.AddRoute(310, handleFetchMessages)
+func toFetchedMessage(m services.Message) FetchedMessage {
+	fm := FetchedMessage{
+		ID:         m.ID,
+		RoomID:     m.RoomID,
+		SenderID:   m.SenderID,
+		SenderName: m.SenderName,
+		Body:       m.Body,
+		CreatedAt:  m.SentAt.Format(time.RFC3339),
+
+		ReplyToID:    m.ReplyToID,
+		ThreadRootID: m.ThreadRootID,
+	}
+	if m.EditedAt != nil {
+		fm.Edited = true
+		fm.EditedAt = m.EditedAt.Format(time.RFC3339)
+	}
+	if m.DeletedAt != nil {
+		fm.Deleted = true
+		fm.DeletedAt = m.DeletedAt.Format(time.RFC3339)
+		fm.Body = ""
+	}
+	return fm
 }
 
-func handleSendMessage(ctx easytcp.Context) {
-	req := ctx.Request()
-	log.Printf("301 send message: id=%d bytes=%d", req.ID(), len(req.Data()))
+type EditMessageRequest struct {
+	MessageID int64  `json:"message_id"`
+	Body      string `json:"body"`
+}
 
-	if !services.IsAuthenticated(ctx.Session()) {
-		sendMessageError(ctx, "not authenticated")
-		return
+func (r *EditMessageRequest) Validate() error {
+	if r.MessageID <= 0 {
+		return invalidField("message_id", "message_id is required")
 	}
+	return validateBody(r.Body)
+}
 
-	var msgReq SendMessageRequest
-	if err := json.Unmarshal(req.Data(), &msgReq); err != nil {
-		sendMessageError(ctx, "invalid request format")
-		return
-	}
+type DeleteMessageRequest struct {
+	MessageID int64 `json:"message_id"`
+}
 
-	if msgReq.UserID == "" || msgReq.RoomID == "" || msgReq.Body == "" {
-		sendMessageError(ctx, "user_id, room_id, and body are required")
-		return
+func (r *DeleteMessageRequest) Validate() error {
+	if r.MessageID <= 0 {
+		return invalidField("message_id", "message_id is required")
 	}
+	return nil
+}
 
-	session := services.GetSession(ctx.Session())
-	if session == nil || session.UserID != msgReq.UserID {
-		sendMessageError(ctx, "user_id mismatch")
-		return
-	}
+func RegisterMessageRoutes(s *easytcp.Server) {
+	handle(s, 301, Authenticated, handleSendMessage)
+	handle(s, 310, Authenticated, handleFetchMessages)
+	handle(s, 311, Authenticated, handleEditMessage)
+	handle(s, 312, Authenticated, handleDeleteMessage)
+}
 
-	saved, err := services.CreateMessage(msgReq.RoomID, msgReq.UserID, session.UserName, msgReq.Body)
+func handleSendMessage(c *Call, req *SendMessageRequest) (interface{}, error) {
+	services.Logf(c, "301 send message: room=%s bytes=%d", req.RoomID, len(req.Body))
 
+	if _, err := requireCapability(c, req.RoomID, services.CapSend); err != nil {
+		return nil, err
+	}
+	if err := requireNotMuted(c, req.RoomID); err != nil {
+		return nil, err
+	}
+	replyTo, rootID, err := resolveReplyTargets(c, req)
 	if err != nil {
-		log.Printf("failed to send message: %v", err)
-		sendMessageError(ctx, "failed to send message")
-		return
+		return nil, err
 	}
 
-	log.Printf("301 send message: saved id=%d room=%s sender=%s", saved.ID, saved.RoomID, saved.SenderID)
+	saved, created, err := services.CreateMessage(c, &services.Message{
+		RoomID:       req.RoomID,
+		SenderID:     c.User.UserID,
+		SenderName:   c.User.UserName,
+		Body:         req.Body,
+		ReplyToID:    req.ReplyToID,
+		ThreadRootID: rootID,
+		ClientMsgID:  req.ClientMsgID,
+	})
+	if err != nil {
+		return nil, storeFailure(err, "failed to send message", "room not found")
+	}
+	if !created && saved.RoomID != req.RoomID {
+		return nil, fail(services.CodeConflict, "client_msg_id was already used in another room", nil)
+	}
 
-	// Ensure sender is tracked in the room for broadcasts.
-	services.AddSessionToRoom(msgReq.RoomID, ctx.Session())
+	// A sent message ends the sender's typing indicator.
+	services.ClearTyping(req.RoomID, c.User.UserID)
 
-	// Broadcast to all sessions in the room (including sender) on route 302.
-	broadcast := SendMessageResponse{
-		Success:    true,
-		Message:    "message delivered",
+	// Broadcast to all subscribed sessions in the room (including sender) on route 302.
+	out := SendMessageResponse{
 		ID:         saved.ID,
 		RoomID:     saved.RoomID,
 		SenderID:   saved.SenderID,
 		SenderName: saved.SenderName,
 		Body:       saved.Body,
 		SentAt:     saved.SentAt.Format(time.RFC3339),
+
+		ReplyToID:    saved.ReplyToID,
+		ThreadRootID: saved.ThreadRootID,
+		ClientMsgID:  saved.ClientMsgID,
 	}
-	if b, err := json.Marshal(broadcast); err == nil {
-		services.BroadcastToRoom(msgReq.RoomID, easytcp.NewMessage(302, b), nil)
+
+	if !created {
+		// A retry of a message that was already saved (and broadcast): answer with the
+		// original so the client can settle its optimistic entry, without a second 302.
+		services.Logf(c, "301 send message: duplicate client_msg_id=%s -> id=%d", saved.ClientMsgID, saved.ID)
+		if saved.ReplyToID != 0 {
+			if target, err := services.GetMessage(c, saved.ReplyToID); err == nil {
+				preview := services.PreviewOf(*target)
+				out.ReplyTo = &preview
+			}
+		}
+		return out, nil
 	}
 
-	resp := SendMessageResponse{
-		Success:    true,
-		Message:    "message sent",
-		ID:         saved.ID,
-		RoomID:     saved.RoomID,
-		SenderID:   saved.SenderID,
-		SenderName: saved.SenderName,
-		Body:       saved.Body,
-		SentAt:     saved.SentAt.Format(time.RFC3339),
+	services.Logf(c, "301 send message: saved id=%d room=%s sender=%s", saved.ID, saved.RoomID, saved.SenderID)
+
+	if replyTo != nil {
+		preview := services.PreviewOf(*replyTo)
+		out.ReplyTo = &preview
 	}
+	services.BroadcastSequenced(req.RoomID, 302, services.Success(out))
 
-	data, _ := json.Marshal(resp)
-	ctx.SetResponseMessage(easytcp.NewMessage(req.ID(), data))
+	return out, nil
 }
 
-func handleFetchMessages(ctx easytcp.Context) {
-	req := ctx.Request()
-	log.Printf("310 fetch messages: id=%d bytes=%d", req.ID(), len(req.Data()))
+// requireNotMuted returns FORBIDDEN, with the mute's reason and end, while the caller
+// is muted in the room.
+func requireNotMuted(c *Call, roomID string) error {
+	mute, err := services.ActiveMute(c, roomID, c.User.UserID)
+	if err != nil {
+		return fail(services.CodeInternal, "failed to check mute", err)
+	}
+	if mute == nil {
+		return nil
+	}
+	details := map[string]interface{}{"reason": mute.Reason}
+	if mute.ExpiresAt != nil {
+		details["muted_until"] = mute.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	return fail(services.CodeForbidden, "you are muted in this room", nil).WithDetails(details)
+}
 
-	if !services.IsAuthenticated(ctx.Session()) {
-		sendFetchMessagesError(ctx, "not authenticated")
-		return
+func handleFetchMessages(c *Call, req *FetchMessagesRequest) (interface{}, error) {
+	services.Logf(c, "310 fetch messages: room=%s before=%s after=%s around=%s before_created_at=%s limit=%d",
+		req.RoomID, req.BeforeID, req.AfterID, req.AroundID, req.BeforeCreatedAt, req.Limit)
+
+	if _, err := requireMember(c, req.RoomID); err != nil {
+		return nil, err
 	}
 
-	var fmReq FetchMessagesRequest
-	if err := json.Unmarshal(req.Data(), &fmReq); err != nil {
-		sendFetchMessagesError(ctx, "invalid request format")
-		return
+	// Validate has checked the cursors, so parse errors cannot happen here.
+	afterID, _ := parseMessageID(req.AfterID)
+	aroundID, _ := parseMessageID(req.AroundID)
+	var beforeCreatedAt time.Time
+	if req.BeforeCreatedAt != "" {
+		beforeCreatedAt, _ = time.Parse(time.RFC3339, req.BeforeCreatedAt)
 	}
 
-	if fmReq.RoomID == "" || fmReq.UserID == "" {
-		sendFetchMessagesError(ctx, "room_id and user_id are required")
-		return
+	if aroundID != 0 {
+		anchor, err := services.GetMessage(c, aroundID)
+		if err != nil && !errors.Is(err, services.ErrNotFound) {
+			return nil, fail(services.CodeInternal, "failed to load message", err)
+		}
+		if err != nil || anchor.RoomID != req.RoomID {
+			return nil, fail(services.CodeNotFound, "message not found", nil)
+		}
+		// Thread replies are not in the main timeline; centre on their root instead.
+		if anchor.ThreadRootID != 0 {
+			aroundID = anchor.ThreadRootID
+		}
 	}
 
-	session := services.GetSession(ctx.Session())
-	if session == nil || session.UserID != fmReq.UserID {
-		sendFetchMessagesError(ctx, "user_id mismatch")
-		return
+	page, err := services.PageMessages(c, services.MessageQuery{
+		RoomID:          req.RoomID,
+		BeforeID:        req.BeforeID,
+		AfterID:         afterID,
+		BeforeCreatedAt: beforeCreatedAt,
+		Limit:           req.Limit,
+		IncludeSystem:   req.IncludeSystem,
+	}, aroundID)
+	if err != nil {
+		return nil, fail(services.CodeInternal, "failed to fetch messages", err)
 	}
+	msgs := page.Messages
 
-	// Track this session in the room so broadcast (302) messages reach it.
-	services.AddSessionToRoom(fmReq.RoomID, ctx.Session())
+	fetched, err := decorateMessages(c, msgs)
+	if err != nil {
+		return nil, err
+	}
 
-	if fmReq.Limit == 0 {
-		fmReq.Limit = 50
+	resp := FetchMessagesResponse{
+		Messages:      fetched,
+		HasMore:       page.HasBefore,
+		HasMoreBefore: page.HasBefore,
+		HasMoreAfter:  page.HasAfter,
 	}
 
-	msgs, hasMore, err := services.ListMessages(fmReq.RoomID, fmReq.BeforeID, fmReq.Limit, fmReq.IncludeSystem)
+	if len(msgs) > 0 {
+		first, last := msgs[0], msgs[len(msgs)-1]
+		resp.NextBeforeID = fmt.Sprintf("%d", last.ID)
+		resp.NextBeforeCreatedAt = last.SentAt.Format(time.RFC3339Nano)
+		resp.NextAfterID = fmt.Sprintf("%d", first.ID)
+	}
+
+	return resp, nil
+}
+
+// decorateMessages converts a page of history for the caller, adding reactions,
+// reply previews and thread reply counts.
+func decorateMessages(c *Call, msgs []services.Message) ([]FetchedMessage, error) {
+	ids := make([]int64, len(msgs))
+	for i, m := range msgs {
+		ids[i] = m.ID
+	}
+	reactions, err := services.SummarizeReactions(c, ids, c.User.UserID)
+	if err != nil {
+		return nil, fail(services.CodeInternal, "failed to fetch reactions", err)
+	}
+	previews, err := services.ReplyPreviews(c, msgs)
 	if err != nil {
-		log.Printf("failed to fetch messages: %v", err)
-		sendFetchMessagesError(ctx, "failed to fetch messages")
-		return
+		return nil, fail(services.CodeInternal, "failed to fetch reply previews", err)
+	}
+	replyCounts, err := services.CountReplies(c, ids)
+	if err != nil {
+		return nil, fail(services.CodeInternal, "failed to count thread replies", err)
 	}
 
 	fetched := make([]FetchedMessage, 0, len(msgs))
 	for _, m := range msgs {
-		fetched = append(fetched, FetchedMessage{
-			ID:         m.ID,
-			RoomID:     m.RoomID,
-			SenderID:   m.SenderID,
-			SenderName: m.SenderName,
-			Body:       m.Body,
-			CreatedAt:  m.SentAt.Format(time.RFC3339),
-		})
+		fm := toFetchedMessage(m)
+		fm.Reactions = reactions[m.ID]
+		if p, ok := previews[m.ReplyToID]; ok {
+			fm.ReplyTo = &p
+		}
+		fm.ReplyCount = replyCounts[m.ID]
+		fetched = append(fetched, fm)
 	}
+	return fetched, nil
+}
 
-	resp := FetchMessagesResponse{
-		Success:  true,
-		Message:  "messages fetched",
-		Messages: fetched,
-		HasMore:  hasMore,
+// resolveReplyTargets checks that reply_to_id and thread_root_id reference messages
+// in the request's room. A reply to a message inside a thread stays in that thread,
+// and a thread_root_id naming a reply is moved up to its root. Returns the replied-to
+// message (or nil) and the thread root to store.
+func resolveReplyTargets(c *Call, req *SendMessageRequest) (*services.Message, int64, error) {
+	var replyTo *services.Message
+	rootID := req.ThreadRootID
+
+	if req.ReplyToID != 0 {
+		m, err := messageInRoom(c, req.ReplyToID, req.RoomID, "reply_to_id")
+		if err != nil {
+			return nil, 0, err
+		}
+		replyTo = m
+		if rootID == 0 {
+			rootID = m.ThreadRootID
+		}
+	}
+	if rootID != 0 {
+		root, err := messageInRoom(c, rootID, req.RoomID, "thread_root_id")
+		if err != nil {
+			return nil, 0, err
+		}
+		if root.ThreadRootID != 0 {
+			rootID = root.ThreadRootID
+		}
 	}
+	return replyTo, rootID, nil
+}
 
-	if len(msgs) > 0 {
-		last := msgs[len(msgs)-1]
-		resp.NextBeforeID = fmt.Sprintf("%d", last.ID)
-		resp.NextBeforeCreatedAt = last.SentAt.Format(time.RFC3339)
+// messageInRoom loads message id and reports a validation error on field unless it is in roomID.
+func messageInRoom(c *Call, id int64, roomID, field string) (*services.Message, error) {
+	m, err := services.GetMessage(c, id)
+	if err != nil && !errors.Is(err, services.ErrNotFound) {
+		return nil, fail(services.CodeInternal, "failed to load referenced message", err)
+	}
+	if err != nil || m.RoomID != roomID {
+		return nil, invalidField(field, field+" must reference a message in this room")
 	}
+	return m, nil
+}
 
-	data, _ := json.Marshal(resp)
-	ctx.SetResponseMessage(easytcp.NewMessage(req.ID(), data))
+// loadMessageForCaller fetches a message and the caller's role in its room.
+// Messages in rooms the caller does not belong to are reported as not found.
+func loadMessageForCaller(c *Call, id int64) (*services.Message, string, error) {
+	msg, err := services.GetMessage(c, id)
+	if err != nil {
+		return nil, "", storeFailure(err, "failed to load message", "message not found")
+	}
+	role, member, err := services.GetMembership(c, msg.RoomID, c.User.UserID)
+	if err != nil {
+		return nil, "", fail(services.CodeInternal, "failed to check room membership", err)
+	}
+	if !member {
+		return nil, "", fail(services.CodeNotFound, "message not found", nil)
+	}
+	return msg, role, nil
 }
 
-func sendFetchMessagesError(ctx easytcp.Context, msg string) {
-	resp := FetchMessagesResponse{Success: false, Message: msg}
-	data, _ := json.Marshal(resp)
-	ctx.SetResponseMessage(easytcp.NewMessage(ctx.Request().ID(), data))
+func handleEditMessage(c *Call, req *EditMessageRequest) (interface{}, error) {
+	msg, role, err := loadMessageForCaller(c, req.MessageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.SenderID != c.User.UserID {
+		return nil, fail(services.CodeForbidden, "only the sender can edit a message", nil)
+	}
+	if err := checkCapability(c, msg.RoomID, role, services.CapSend); err != nil {
+		return nil, err
+	}
+	if msg.DeletedAt != nil {
+		return nil, fail(services.CodeConflict, "message was deleted", nil)
+	}
+
+	edited, err := services.EditMessage(c, msg.ID, req.Body, c.User.UserName)
+	if err != nil {
+		return nil, storeFailure(err, "failed to edit message", "message not found")
+	}
+	services.Logf(c, "311 edit message: id=%d room=%s", edited.ID, edited.RoomID)
+
+	out := toFetchedMessage(*edited)
+	services.BroadcastRoomEvent(edited.RoomID, services.EventMessageEdited, c.User.UserID, out)
+	return out, nil
 }
 
-func sendMessageError(ctx easytcp.Context, msg string) {
-	resp := SendMessageResponse{Success: false, Message: msg}
-	data, _ := json.Marshal(resp)
-	ctx.SetResponseMessage(easytcp.NewMessage(ctx.Request().ID(), data))
+// handleDeleteMessage tombstones a message. Senders may delete their own unless the
+// room is archived; other messages need CapDeleteOthers. Deleting a tombstone returns it again.
+func handleDeleteMessage(c *Call, req *DeleteMessageRequest) (interface{}, error) {
+	msg, role, err := loadMessageForCaller(c, req.MessageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.SenderID != c.User.UserID {
+		err = checkCapability(c, msg.RoomID, role, services.CapDeleteOthers)
+	} else {
+		err = checkRoomWritable(c, msg.RoomID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if msg.DeletedAt != nil {
+		return toFetchedMessage(*msg), nil
+	}
+
+	deleted, err := services.DeleteMessage(c, msg.ID)
+	if err != nil {
+		return nil, storeFailure(err, "failed to delete message", "message not found")
+	}
+	services.Logf(c, "312 delete message: id=%d room=%s by=%s", deleted.ID, deleted.RoomID, c.User.UserID)
+
+	out := toFetchedMessage(*deleted)
+	services.BroadcastRoomEvent(deleted.RoomID, services.EventMessageDeleted, c.User.UserID, out)
+	return out, nil
 }
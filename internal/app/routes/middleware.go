@@ -0,0 +1,108 @@
+package routes
+
+import (
+	"encoding/json"
+	"sync"
+
+	"musick-server/internal/app/services"
+
+	"github.com/DarthPestilane/easytcp"
+)
+
+// Access declares who may call a route.
+type Access int
+
+const (
+	// Authenticated routes require a logged-in session with an unexpired token (the default).
+	Authenticated Access = iota
+	// Public routes may be called before login (e.g. login itself).
+	Public
+)
+
+// sessionKey is the context key under which AuthMiddleware stores the caller's session.
+const sessionKey = "session"
+
+var (
+	routeAccess   = make(map[interface{}]Access)
+	routeAccessMu sync.RWMutex
+)
+
+// setRouteAccess records a route's access level; routes never declared are Authenticated.
+func setRouteAccess(id interface{}, access Access) {
+	routeAccessMu.Lock()
+	defer routeAccessMu.Unlock()
+	routeAccess[id] = access
+}
+
+func accessFor(id interface{}) Access {
+	routeAccessMu.RLock()
+	defer routeAccessMu.RUnlock()
+	return routeAccess[id]
+}
+
+// maxRequestIDLen bounds client-supplied correlation IDs so they stay log-friendly.
+const maxRequestIDLen = 64
+
+// RequestIDMiddleware reads the optional "request_id" field from the JSON body
+// (generating one when absent or unusable) and stores it on the context, so it is
+// echoed in the response envelope, prefixed to log lines and sent to Supabase.
+func RequestIDMiddleware(next easytcp.HandlerFunc) easytcp.HandlerFunc {
+	return func(ctx easytcp.Context) {
+		var peek struct {
+			RequestID string `json:"request_id"`
+		}
+		// Bodies that are not JSON objects (e.g. echo) simply carry no ID.
+		_ = json.Unmarshal(ctx.Request().Data(), &peek)
+
+		id := peek.RequestID
+		if !validRequestID(id) {
+			id = services.NewRequestID()
+		}
+		ctx.Set(services.RequestIDKey, id)
+		next(ctx)
+	}
+}
+
+// validRequestID accepts short IDs made of printable ASCII without spaces.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// AuthMiddleware rejects requests to Authenticated routes from sessions that are not
+// logged in (or whose token expired) and stores the caller's session on the context.
+func AuthMiddleware(next easytcp.HandlerFunc) easytcp.HandlerFunc {
+	return func(ctx easytcp.Context) {
+		sess := ctx.Session()
+		if services.IsAuthenticated(sess) {
+			ctx.Set(sessionKey, services.GetSession(sess))
+			services.TouchPresence(sess)
+		} else if accessFor(ctx.Request().ID()) != Public {
+			code, msg := services.CodeUnauthenticated, "not authenticated"
+			if services.GetSession(sess) != nil {
+				code, msg = services.CodeAuthExpired, "authentication expired, refresh your token"
+			}
+			services.Logf(ctx, "rejected route %v from %s: %s", ctx.Request().ID(), sess.Conn().RemoteAddr(), msg)
+			respond(ctx, services.Failure(code, msg, nil))
+			return
+		}
+		next(ctx)
+	}
+}
+
+// sessionFromContext returns the session stored by AuthMiddleware, or nil.
+func sessionFromContext(ctx easytcp.Context) *services.UserSession {
+	if v, ok := ctx.Get(sessionKey); ok {
+		if us, ok := v.(*services.UserSession); ok {
+			return us
+		}
+	}
+	return nil
+}
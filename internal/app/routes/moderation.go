@@ -0,0 +1,273 @@
+package routes
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"musick-server/internal/app/services"
+
+	"github.com/DarthPestilane/easytcp"
+)
+
+// Moderation limits: reasons are in characters, mutes last at most maxMuteDuration.
+const (
+	maxModerationReasonLen = 200
+	maxMuteDuration        = 30 * 24 * time.Hour
+)
+
+// ModerateMemberRequest names the member a kick, ban, unban or unmute applies to.
+// Every action needs a reason; it is shown to the room and kept in the moderation log.
+type ModerateMemberRequest struct {
+	RoomID string `json:"room_id"`
+	UserID string `json:"user_id"`
+	Reason string `json:"reason"`
+}
+
+func (r *ModerateMemberRequest) Validate() error {
+	return validateModeration(r.RoomID, r.UserID, r.Reason)
+}
+
+type MuteMemberRequest struct {
+	RoomID      string `json:"room_id"`
+	UserID      string `json:"user_id"`
+	Reason      string `json:"reason"`
+	DurationSec int64  `json:"duration_sec"`
+}
+
+func (r *MuteMemberRequest) Validate() error {
+	if err := validateModeration(r.RoomID, r.UserID, r.Reason); err != nil {
+		return err
+	}
+	if r.DurationSec <= 0 || r.DurationSec > int64(maxMuteDuration/time.Second) {
+		return invalidField("duration_sec", fmt.Sprintf("duration_sec must be 1-%d", int64(maxMuteDuration/time.Second)))
+	}
+	return nil
+}
+
+func validateModeration(roomID, userID, reason string) error {
+	if roomID == "" {
+		return invalidField("room_id", "room_id is required")
+	}
+	if userID == "" {
+		return invalidField("user_id", "user_id is required")
+	}
+	if strings.TrimSpace(reason) == "" {
+		return invalidField("reason", "reason is required")
+	}
+	if utf8.RuneCountInString(reason) > maxModerationReasonLen {
+		return invalidField("reason", fmt.Sprintf("reason exceeds %d characters", maxModerationReasonLen))
+	}
+	return nil
+}
+
+type ModerationLogRequest struct {
+	RoomID   string `json:"room_id"`
+	BeforeID string `json:"before_id"`
+	Limit    int    `json:"limit"`
+}
+
+func (r *ModerationLogRequest) Validate() error {
+	if r.RoomID == "" {
+		return invalidField("room_id", "room_id is required")
+	}
+	if r.BeforeID != "" {
+		if id, err := strconv.ParseInt(r.BeforeID, 10, 64); err != nil || id <= 0 {
+			return invalidField("before_id", "before_id must be a moderation entry id")
+		}
+	}
+	return nil
+}
+
+// ModerationEntryResponse is a moderation log entry with display names, returned by
+// the moderation routes, pushed as the 303 event data and listed by route 238.
+type ModerationEntryResponse struct {
+	ID         int64  `json:"id"`
+	RoomID     string `json:"room_id"`
+	Action     string `json:"action"`
+	TargetID   string `json:"target_id"`
+	TargetName string `json:"target_name"`
+	ActorID    string `json:"actor_id"`
+	ActorName  string `json:"actor_name"`
+	Reason     string `json:"reason"`
+	ExpiresAt  string `json:"expires_at,omitempty"`
+	CreatedAt  string `json:"created_at"`
+}
+
+type ModerationLogResponse struct {
+	RoomID       string                    `json:"room_id"`
+	Entries      []ModerationEntryResponse `json:"entries"`
+	HasMore      bool                      `json:"has_more"`
+	NextBeforeID string                    `json:"next_before_id,omitempty"`
+}
+
+// moderationEvents maps each action to the room event announcing it.
+var moderationEvents = map[string]string{
+	services.ModKick:   services.EventMemberKicked,
+	services.ModBan:    services.EventMemberBanned,
+	services.ModUnban:  services.EventMemberUnbanned,
+	services.ModMute:   services.EventMemberMuted,
+	services.ModUnmute: services.EventMemberUnmuted,
+}
+
+func RegisterModerationRoutes(s *easytcp.Server) {
+	handle(s, 233, Authenticated, handleKickMember)
+	handle(s, 234, Authenticated, handleBanMember)
+	handle(s, 235, Authenticated, handleUnbanMember)
+	handle(s, 236, Authenticated, handleMuteMember)
+	handle(s, 237, Authenticated, handleUnmuteMember)
+	handle(s, 238, Authenticated, handleModerationLog)
+}
+
+// authorizeModeration checks the caller holds CapKick and outranks the target. When
+// mustBeMember is set the target has to belong to the room.
+func authorizeModeration(c *Call, roomID, targetID string, mustBeMember bool) error {
+	actorRole, err := requireCapability(c, roomID, services.CapKick)
+	if err != nil {
+		return err
+	}
+	if targetID == c.User.UserID {
+		return fail(services.CodeForbidden, "you cannot moderate yourself", nil)
+	}
+	targetRole, member, err := services.GetMembership(c, roomID, targetID)
+	if err != nil {
+		return fail(services.CodeInternal, "failed to check room membership", err)
+	}
+	if mustBeMember && !member {
+		return fail(services.CodeNotFound, "user is not a member of this room", nil)
+	}
+	if member && services.RoleRank(targetRole) >= services.RoleRank(actorRole) {
+		return fail(services.CodeForbidden, "you can only moderate members ranked below you", nil)
+	}
+	return nil
+}
+
+func handleKickMember(c *Call, req *ModerateMemberRequest) (interface{}, error) {
+	services.Logf(c, "233 kick member: room=%s user=%s by=%s", req.RoomID, req.UserID, c.User.UserID)
+	if err := authorizeModeration(c, req.RoomID, req.UserID, true); err != nil {
+		return nil, err
+	}
+	e, err := services.KickMember(c, req.RoomID, req.UserID, c.User.UserID, req.Reason)
+	if err != nil {
+		return nil, storeFailure(err, "failed to kick member", "user is not a member of this room")
+	}
+	return announceModeration(c, e, true), nil
+}
+
+func handleBanMember(c *Call, req *ModerateMemberRequest) (interface{}, error) {
+	services.Logf(c, "234 ban member: room=%s user=%s by=%s", req.RoomID, req.UserID, c.User.UserID)
+	if err := authorizeModeration(c, req.RoomID, req.UserID, false); err != nil {
+		return nil, err
+	}
+	e, err := services.BanMember(c, req.RoomID, req.UserID, c.User.UserID, req.Reason)
+	if err != nil {
+		return nil, storeFailure(err, "failed to ban member, retry to complete the ban", "room not found")
+	}
+	return announceModeration(c, e, true), nil
+}
+
+func handleUnbanMember(c *Call, req *ModerateMemberRequest) (interface{}, error) {
+	services.Logf(c, "235 unban member: room=%s user=%s by=%s", req.RoomID, req.UserID, c.User.UserID)
+	if err := authorizeModeration(c, req.RoomID, req.UserID, false); err != nil {
+		return nil, err
+	}
+	e, err := services.UnbanMember(c, req.RoomID, req.UserID, c.User.UserID, req.Reason)
+	if err != nil {
+		return nil, storeFailure(err, "failed to unban member", "user is not banned from this room")
+	}
+	return announceModeration(c, e, false), nil
+}
+
+func handleMuteMember(c *Call, req *MuteMemberRequest) (interface{}, error) {
+	services.Logf(c, "236 mute member: room=%s user=%s by=%s for=%ds", req.RoomID, req.UserID, c.User.UserID, req.DurationSec)
+	if err := authorizeModeration(c, req.RoomID, req.UserID, true); err != nil {
+		return nil, err
+	}
+	until := time.Now().Add(time.Duration(req.DurationSec) * time.Second)
+	e, err := services.MuteMember(c, req.RoomID, req.UserID, c.User.UserID, req.Reason, until)
+	if err != nil {
+		return nil, fail(services.CodeInternal, "failed to mute member", err)
+	}
+	services.ClearTyping(req.RoomID, req.UserID)
+	return announceModeration(c, e, false), nil
+}
+
+func handleUnmuteMember(c *Call, req *ModerateMemberRequest) (interface{}, error) {
+	services.Logf(c, "237 unmute member: room=%s user=%s by=%s", req.RoomID, req.UserID, c.User.UserID)
+	if err := authorizeModeration(c, req.RoomID, req.UserID, false); err != nil {
+		return nil, err
+	}
+	e, err := services.UnmuteMember(c, req.RoomID, req.UserID, c.User.UserID, req.Reason)
+	if err != nil {
+		return nil, storeFailure(err, "failed to unmute member", "user is not muted in this room")
+	}
+	return announceModeration(c, e, false), nil
+}
+
+// announceModeration broadcasts the action to the room and returns it for the caller.
+// A removed member's connections get the event first and are then unsubscribed.
+func announceModeration(c *Call, e *services.ModerationEntry, removed bool) ModerationEntryResponse {
+	out := toModerationEntries(c, []services.ModerationEntry{*e})[0]
+	services.BroadcastRoomEvent(e.RoomID, moderationEvents[e.Action], e.TargetID, out)
+	if removed {
+		services.ClearTyping(e.RoomID, e.TargetID)
+		dropped := services.RemoveUserFromRoom(e.RoomID, e.TargetID)
+		services.Logf(c, "%s: room=%s user=%s sessions=%d", e.Action, e.RoomID, e.TargetID, dropped)
+	}
+	return out
+}
+
+func toModerationEntries(c *Call, entries []services.ModerationEntry) []ModerationEntryResponse {
+	ids := make([]string, 0, 2*len(entries))
+	for _, e := range entries {
+		ids = append(ids, e.TargetID, e.ActorID)
+	}
+	names := services.UserNames(c, ids)
+
+	out := make([]ModerationEntryResponse, len(entries))
+	for i, e := range entries {
+		out[i] = ModerationEntryResponse{
+			ID:         e.ID,
+			RoomID:     e.RoomID,
+			Action:     e.Action,
+			TargetID:   e.TargetID,
+			TargetName: names[e.TargetID],
+			ActorID:    e.ActorID,
+			ActorName:  names[e.ActorID],
+			Reason:     e.Reason,
+			CreatedAt:  e.CreatedAt.UTC().Format(time.RFC3339),
+		}
+		if e.ExpiresAt != nil {
+			out[i].ExpiresAt = e.ExpiresAt.UTC().Format(time.RFC3339)
+		}
+	}
+	return out
+}
+
+// handleModerationLog pages the room's moderation actions newest-first; it needs the
+// same capability as moderating.
+func handleModerationLog(c *Call, req *ModerationLogRequest) (interface{}, error) {
+	if _, err := requireCapability(c, req.RoomID, services.CapKick); err != nil {
+		return nil, err
+	}
+	var beforeID int64
+	if req.BeforeID != "" {
+		beforeID, _ = strconv.ParseInt(req.BeforeID, 10, 64)
+	}
+
+	entries, hasMore, err := services.ListModerationLog(c, req.RoomID, beforeID, req.Limit)
+	if err != nil {
+		return nil, fail(services.CodeInternal, "failed to fetch moderation log", err)
+	}
+	resp := ModerationLogResponse{
+		RoomID:  req.RoomID,
+		Entries: toModerationEntries(c, entries),
+		HasMore: hasMore,
+	}
+	if hasMore {
+		resp.NextBeforeID = strconv.FormatInt(entries[len(entries)-1].ID, 10)
+	}
+	return resp, nil
+}
@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"musick-server/internal/app/services"
+
+	"github.com/DarthPestilane/easytcp"
+)
+
+// OutboxMiddleware moves each route's response into the session's outbound queue,
+// so replies and room pushes share one ordered writer. It must be the outermost
+// middleware so it also catches rejections produced by the others.
+func OutboxMiddleware(next easytcp.HandlerFunc) easytcp.HandlerFunc {
+	return func(ctx easytcp.Context) {
+		next(ctx)
+		if resp := ctx.Response(); resp != nil {
+			services.EnqueueResponse(ctx.Session(), resp)
+			// easytcp's own writer skips contexts without a response.
+			ctx.SetResponseMessage(nil)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package routes
+
+import (
+	"time"
+
+	"musick-server/internal/app/services"
+
+	"github.com/DarthPestilane/easytcp"
+)
+
+type ListMembersRequest struct {
+	RoomID string `json:"room_id"`
+}
+
+func (r *ListMembersRequest) Validate() error {
+	if r.RoomID == "" {
+		return invalidField("room_id", "room_id is required")
+	}
+	return nil
+}
+
+type ListMembersResponse struct {
+	RoomID  string       `json:"room_id"`
+	Members []RoomMember `json:"members"`
+}
+
+type RoomMember struct {
+	UserID     string `json:"user_id"`
+	UserName   string `json:"user_name,omitempty"`
+	Role       string `json:"role"`
+	Status     string `json:"status"`
+	LastSeenAt string `json:"last_seen_at,omitempty"`
+	JoinedAt   string `json:"joined_at,omitempty"`
+}
+
+type SetPresenceRequest struct {
+	Status string `json:"status"`
+}
+
+func (r *SetPresenceRequest) Validate() error {
+	switch services.PresenceStatus(r.Status) {
+	case services.PresenceOnline, services.PresenceIdle:
+		return nil
+	}
+	return invalidField("status", "status must be online or idle")
+}
+
+func RegisterPresenceRoutes(s *easytcp.Server) {
+	handle(s, 230, Authenticated, handleListMembers)
+	handle(s, 240, Authenticated, handleSetPresence)
+}
+
+func handleListMembers(c *Call, req *ListMembersRequest) (interface{}, error) {
+	if _, err := requireMember(c, req.RoomID); err != nil {
+		return nil, err
+	}
+
+	members, err := services.ListRoomMembers(c, req.RoomID)
+	if err != nil {
+		return nil, fail(services.CodeInternal, "failed to list members", err)
+	}
+
+	out := make([]RoomMember, 0, len(members))
+	for _, m := range members {
+		rm := RoomMember{
+			UserID:     m.UserID,
+			UserName:   m.UserName,
+			Role:       m.Role,
+			Status:     string(m.Presence.Status),
+			LastSeenAt: m.Presence.LastSeenAt,
+		}
+		if !m.JoinedAt.IsZero() {
+			rm.JoinedAt = m.JoinedAt.Format(time.RFC3339)
+		}
+		out = append(out, rm)
+	}
+
+	return ListMembersResponse{RoomID: req.RoomID, Members: out}, nil
+}
+
+// handleSetPresence lets a client mark this connection idle (e.g. app in background) or active again.
+func handleSetPresence(c *Call, req *SetPresenceRequest) (interface{}, error) {
+	services.SetSessionIdle(c.Session(), services.PresenceStatus(req.Status) == services.PresenceIdle)
+	return services.GetPresence(c.User.UserID), nil
+}
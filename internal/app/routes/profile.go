@@ -0,0 +1,138 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"musick-server/internal/app/services"
+
+	"github.com/DarthPestilane/easytcp"
+)
+
+// Profile field limits, in characters (maxAvatarURLLen in bytes).
+const (
+	maxUserNameLen  = 32
+	maxBioLen       = 280
+	maxAvatarURLLen = 512
+)
+
+// zeroWidthJoiner is allowed in names and bios so multi-part emoji stay intact.
+const zeroWidthJoiner = '\u200d'
+
+type GetProfileRequest struct {
+	// UserID defaults to the caller.
+	UserID string `json:"user_id"`
+}
+
+// UpdateProfileRequest changes the caller's profile; omitted fields are kept and
+// an empty avatar_url or bio clears it.
+type UpdateProfileRequest struct {
+	UserName  *string `json:"user_name"`
+	AvatarURL *string `json:"avatar_url"`
+	Bio       *string `json:"bio"`
+}
+
+func (r *UpdateProfileRequest) Validate() error {
+	if r.UserName == nil && r.AvatarURL == nil && r.Bio == nil {
+		return fail(services.CodeValidationFailed, "at least one of user_name, avatar_url and bio is required", nil)
+	}
+	if r.UserName != nil {
+		name := *r.UserName
+		if name == "" || utf8.RuneCountInString(name) > maxUserNameLen {
+			return invalidField("user_name", fmt.Sprintf("user_name must be 1-%d characters", maxUserNameLen))
+		}
+		if strings.TrimSpace(name) != name {
+			return invalidField("user_name", "user_name must not start or end with spaces")
+		}
+		if hasControlChars(name, false) {
+			return invalidField("user_name", "user_name contains invalid characters")
+		}
+	}
+	if r.AvatarURL != nil && *r.AvatarURL != "" {
+		if !validAvatarURL(*r.AvatarURL) {
+			return invalidField("avatar_url", fmt.Sprintf("avatar_url must be an https URL of at most %d bytes", maxAvatarURLLen))
+		}
+	}
+	if r.Bio != nil {
+		if utf8.RuneCountInString(*r.Bio) > maxBioLen {
+			return invalidField("bio", fmt.Sprintf("bio exceeds %d characters", maxBioLen))
+		}
+		if hasControlChars(*r.Bio, true) {
+			return invalidField("bio", "bio contains invalid characters")
+		}
+	}
+	return nil
+}
+
+// hasControlChars reports whether s has non-printable characters other than the
+// zero-width joiner (and newlines when multiline).
+func hasControlChars(s string, multiline bool) bool {
+	return strings.IndexFunc(s, func(c rune) bool {
+		return !unicode.IsPrint(c) && c != zeroWidthJoiner && !(multiline && c == '\n')
+	}) >= 0
+}
+
+// validAvatarURL accepts absolute https URLs made of printable ASCII.
+func validAvatarURL(raw string) bool {
+	if len(raw) > maxAvatarURLLen {
+		return false
+	}
+	for i := 0; i < len(raw); i++ {
+		if raw[i] <= ' ' || raw[i] > '~' {
+			return false
+		}
+	}
+	u, err := url.Parse(raw)
+	return err == nil && u.Scheme == "https" && u.Host != "" && u.User == nil
+}
+
+type ProfileResponse struct {
+	UserID    string `json:"user_id"`
+	UserName  string `json:"user_name"`
+	AvatarURL string `json:"avatar_url,omitempty"`
+	Bio       string `json:"bio,omitempty"`
+}
+
+func toProfileResponse(p *services.Profile) ProfileResponse {
+	return ProfileResponse{UserID: p.UserID, UserName: p.UserName, AvatarURL: p.AvatarURL, Bio: p.Bio}
+}
+
+func RegisterProfileRoutes(s *easytcp.Server) {
+	handle(s, 501, Authenticated, handleGetProfile)
+	handle(s, 502, Authenticated, handleUpdateProfile)
+}
+
+func handleGetProfile(c *Call, req *GetProfileRequest) (interface{}, error) {
+	userID := req.UserID
+	if userID == "" {
+		userID = c.User.UserID
+	}
+
+	p, err := services.GetProfile(c, userID)
+	if errors.Is(err, services.ErrNotFound) && userID == c.User.UserID {
+		// Logged in before profiles were recorded: show what the session knows.
+		p, err = &services.Profile{UserID: userID, UserName: c.User.UserName}, nil
+	}
+	if err != nil {
+		return nil, storeFailure(err, "failed to fetch profile", "profile not found")
+	}
+	return toProfileResponse(p), nil
+}
+
+func handleUpdateProfile(c *Call, req *UpdateProfileRequest) (interface{}, error) {
+	services.Logf(c, "502 update profile: user=%s", c.User.UserID)
+
+	p, err := services.UpdateProfile(c, c.User.UserID, c.User.UserName, services.ProfileUpdate{
+		UserName:  req.UserName,
+		AvatarURL: req.AvatarURL,
+		Bio:       req.Bio,
+	})
+	if err != nil {
+		return nil, fail(services.CodeInternal, "failed to update profile", err)
+	}
+	return toProfileResponse(p), nil
+}
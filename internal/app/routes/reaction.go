@@ -0,0 +1,89 @@
+package routes
+
+import (
+	"strings"
+	"unicode"
+
+	"musick-server/internal/app/services"
+
+	"github.com/DarthPestilane/easytcp"
+)
+
+// maxEmojiBytes fits multi-codepoint emoji (skin tones, ZWJ sequences) but not text.
+const maxEmojiBytes = 32
+
+type ReactionRequest struct {
+	MessageID int64  `json:"message_id"`
+	Emoji     string `json:"emoji"`
+}
+
+func (r *ReactionRequest) Validate() error {
+	if r.MessageID <= 0 {
+		return invalidField("message_id", "message_id is required")
+	}
+	if r.Emoji == "" {
+		return invalidField("emoji", "emoji is required")
+	}
+	if len(r.Emoji) > maxEmojiBytes || strings.IndexFunc(r.Emoji, func(c rune) bool {
+		return unicode.IsSpace(c) || unicode.IsControl(c)
+	}) >= 0 {
+		return invalidField("emoji", "emoji must be a single emoji")
+	}
+	return nil
+}
+
+type ReactionResponse struct {
+	MessageID int64  `json:"message_id"`
+	Emoji     string `json:"emoji"`
+	Count     int    `json:"count"`
+	// Changed is false when the reaction was already present (add) or absent (remove).
+	Changed bool `json:"changed"`
+}
+
+func RegisterReactionRoutes(s *easytcp.Server) {
+	handle(s, 313, Authenticated, handleAddReaction)
+	handle(s, 314, Authenticated, handleRemoveReaction)
+}
+
+func handleAddReaction(c *Call, req *ReactionRequest) (interface{}, error) {
+	msg, role, err := loadMessageForCaller(c, req.MessageID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCapability(c, msg.RoomID, role, services.CapSend); err != nil {
+		return nil, err
+	}
+	if msg.DeletedAt != nil {
+		return nil, fail(services.CodeConflict, "message was deleted", nil)
+	}
+
+	delta, changed, err := services.AddReaction(c, msg.ID, c.User.UserID, req.Emoji)
+	if err != nil {
+		return nil, storeFailure(err, "failed to add reaction", "message not found")
+	}
+	if changed {
+		services.BroadcastRoomEvent(msg.RoomID, services.EventReactionAdded, c.User.UserID, delta)
+	}
+
+	return ReactionResponse{MessageID: delta.MessageID, Emoji: delta.Emoji, Count: delta.Count, Changed: changed}, nil
+}
+
+func handleRemoveReaction(c *Call, req *ReactionRequest) (interface{}, error) {
+	msg, role, err := loadMessageForCaller(c, req.MessageID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCapability(c, msg.RoomID, role, services.CapSend); err != nil {
+		return nil, err
+	}
+
+	delta, changed, err := services.RemoveReaction(c, msg.ID, c.User.UserID, req.Emoji)
+	if err != nil {
+		return nil, fail(services.CodeInternal, "failed to remove reaction", err)
+	}
+	if changed {
+		services.BroadcastRoomEvent(msg.RoomID, services.EventReactionRemoved, c.User.UserID, delta)
+	}
+
+	return ReactionResponse{MessageID: delta.MessageID, Emoji: delta.Emoji, Count: delta.Count, Changed: changed}, nil
+}
@@ -0,0 +1,87 @@
+package routes
+
+import (
+	"fmt"
+
+	"musick-server/internal/app/services"
+
+	"github.com/DarthPestilane/easytcp"
+)
+
+// maxResumeRooms bounds how many rooms one resume request may name.
+const maxResumeRooms = 100
+
+type ResumeRequest struct {
+	// Epoch is the value returned by 220/330 before the reconnect.
+	Epoch string            `json:"epoch"`
+	Rooms []ResumeRoomState `json:"rooms"`
+}
+
+// ResumeRoomState is the last seq the client applied for a room.
+type ResumeRoomState struct {
+	RoomID  string `json:"room_id"`
+	LastSeq int64  `json:"last_seq"`
+}
+
+func (r *ResumeRequest) Validate() error {
+	if len(r.Rooms) == 0 {
+		return invalidField("rooms", "rooms is required")
+	}
+	if len(r.Rooms) > maxResumeRooms {
+		return invalidField("rooms", fmt.Sprintf("at most %d rooms per request", maxResumeRooms))
+	}
+	for _, room := range r.Rooms {
+		if room.RoomID == "" {
+			return invalidField("rooms", "room_id is required")
+		}
+		if room.LastSeq < 0 {
+			return invalidField("rooms", "last_seq must not be negative")
+		}
+	}
+	return nil
+}
+
+type ResumeResponse struct {
+	Epoch string              `json:"epoch"`
+	Rooms []ResumedRoomStatus `json:"rooms"`
+}
+
+// ResumedRoomStatus is the outcome for one room. Code is set (and nothing was
+// subscribed) when the room could not be resumed, e.g. FORBIDDEN after being removed.
+type ResumedRoomStatus struct {
+	RoomID   string             `json:"room_id"`
+	Seq      int64              `json:"seq"`
+	Replayed int                `json:"replayed"`
+	Refetch  bool               `json:"refetch,omitempty"`
+	Code     services.ErrorCode `json:"code,omitempty"`
+}
+
+func RegisterResumeRoutes(s *easytcp.Server) {
+	handle(s, 330, Authenticated, handleResume)
+}
+
+// handleResume re-subscribes the connection to each room and replays the 302/303
+// pushes it missed; the replayed pushes are queued before this response.
+func handleResume(c *Call, req *ResumeRequest) (interface{}, error) {
+	services.Logf(c, "330 resume: user=%s rooms=%d", c.User.UserID, len(req.Rooms))
+
+	out := ResumeResponse{Epoch: services.ServerEpoch(), Rooms: make([]ResumedRoomStatus, 0, len(req.Rooms))}
+	budget := services.ReplayBudget()
+	for _, room := range req.Rooms {
+		status := ResumedRoomStatus{RoomID: room.RoomID}
+		_, member, err := services.GetMembership(c, room.RoomID, c.User.UserID)
+		switch {
+		case err != nil:
+			services.Logf(c, "330 resume: membership check failed room=%s: %v", room.RoomID, err)
+			status.Code = services.CodeInternal
+		case !member:
+			status.Code = services.CodeForbidden
+		default:
+			res := services.ResumeRoom(room.RoomID, c.Session(), req.Epoch, room.LastSeq, budget)
+			budget -= res.Replayed
+			status.Seq, status.Replayed, status.Refetch = res.Seq, res.Replayed, res.Refetch
+		}
+		out.Rooms = append(out.Rooms, status)
+	}
+	return out, nil
+}
@@ -0,0 +1,99 @@
+package routes
+
+import (
+	"errors"
+
+	"musick-server/internal/app/services"
+
+	"github.com/DarthPestilane/easytcp"
+)
+
+type MemberRoleRequest struct {
+	RoomID string `json:"room_id"`
+	UserID string `json:"user_id"`
+	// Role is the new role: admin, member or read_only. Ownership is not assignable.
+	Role string `json:"role"`
+}
+
+func (r *MemberRoleRequest) Validate() error {
+	if r.RoomID == "" {
+		return invalidField("room_id", "room_id is required")
+	}
+	if r.UserID == "" {
+		return invalidField("user_id", "user_id is required")
+	}
+	if !services.ValidRole(r.Role) || r.Role == services.RoleOwner {
+		return invalidField("role", "role must be admin, member or read_only")
+	}
+	return nil
+}
+
+type MemberRoleResponse struct {
+	RoomID       string `json:"room_id"`
+	UserID       string `json:"user_id"`
+	Role         string `json:"role"`
+	PreviousRole string `json:"previous_role"`
+}
+
+func RegisterRoleRoutes(s *easytcp.Server) {
+	handle(s, 231, Authenticated, handlePromoteMember)
+	handle(s, 232, Authenticated, handleDemoteMember)
+}
+
+func handlePromoteMember(c *Call, req *MemberRoleRequest) (interface{}, error) {
+	return changeMemberRole(c, req, true)
+}
+
+func handleDemoteMember(c *Call, req *MemberRoleRequest) (interface{}, error) {
+	return changeMemberRole(c, req, false)
+}
+
+// changeMemberRole moves a member up (promote) or down the role ladder. The caller
+// needs CapManageRoles and must outrank both the member's current and new role.
+func changeMemberRole(c *Call, req *MemberRoleRequest, promote bool) (interface{}, error) {
+	route := 232
+	if promote {
+		route = 231
+	}
+	services.Logf(c, "%d member role: room=%s user=%s role=%s by=%s", route, req.RoomID, req.UserID, req.Role, c.User.UserID)
+
+	actorRole, err := requireCapability(c, req.RoomID, services.CapManageRoles)
+	if err != nil {
+		return nil, err
+	}
+	if req.UserID == c.User.UserID {
+		return nil, fail(services.CodeForbidden, "you cannot change your own role", nil)
+	}
+
+	current, member, err := services.GetMembership(c, req.RoomID, req.UserID)
+	if err != nil {
+		return nil, fail(services.CodeInternal, "failed to check room membership", err)
+	}
+	if !member {
+		return nil, fail(services.CodeNotFound, "user is not a member of this room", nil)
+	}
+	if promote && services.RoleRank(req.Role) <= services.RoleRank(current) {
+		return nil, invalidField("role", "promotion must move to a higher role than "+current)
+	}
+	if !promote && services.RoleRank(req.Role) >= services.RoleRank(current) {
+		return nil, invalidField("role", "demotion must move to a lower role than "+current)
+	}
+	if !services.CanManageRole(actorRole, current, req.Role) {
+		return nil, fail(services.CodeForbidden, "your room role cannot manage this member's role", nil)
+	}
+
+	if err := services.SetMemberRole(c, req.RoomID, req.UserID, req.Role); err != nil {
+		if errors.Is(err, services.ErrNotFound) {
+			return nil, fail(services.CodeNotFound, "user is not a member of this room", nil)
+		}
+		return nil, fail(services.CodeInternal, "failed to change member role", err)
+	}
+
+	out := MemberRoleResponse{RoomID: req.RoomID, UserID: req.UserID, Role: req.Role, PreviousRole: current}
+	services.BroadcastRoomEvent(req.RoomID, services.EventRoleChanged, req.UserID, map[string]string{
+		"role":          req.Role,
+		"previous_role": current,
+		"changed_by":    c.User.UserID,
+	})
+	return out, nil
+}
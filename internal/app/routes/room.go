@@ -1,8 +1,7 @@
 package routes
 
 import (
-	"encoding/json"
-	"log"
+	"slices"
 
 	"musick-server/internal/app/services"
 
@@ -10,14 +9,18 @@ import (
 )
 
 type CreateRoomRequest struct {
-	UserID    string `json:"user_id"`
 	RoomName  string `json:"room_name"`
 	IsPrivate bool   `json:"is_private"`
 }
 
+func (r *CreateRoomRequest) Validate() error {
+	if r.RoomName == "" {
+		return invalidField("room_name", "room_name is required")
+	}
+	return nil
+}
+
 type CreateRoomResponse struct {
-	Success   bool   `json:"success"`
-	Message   string `json:"message"`
 	RoomID    string `json:"room_id,omitempty"`
 	RoomCode  string `json:"room_code,omitempty"`
 	RoomName  string `json:"room_name,omitempty"`
@@ -25,126 +28,64 @@ type CreateRoomResponse struct {
 }
 
 type ListRoomsRequest struct {
-	UserID string `json:"user_id"`
+	// IncludeArchived also lists archived rooms, which are hidden by default.
+	IncludeArchived bool `json:"include_archived"`
 }
 
 type ListRoomsResponse struct {
-	Success bool            `json:"success"`
-	Message string          `json:"message"`
-	Rooms   []services.Room `json:"rooms,omitempty"`
+	Rooms []ListedRoom `json:"rooms,omitempty"`
 }
 
-func RegisterRoomRoutes(s *easytcp.Server) {
-	s.AddRoute(201, handleCreateRoom)
-	s.AddRoute(210, handleListRooms)
+// ListedRoom is a room with the caller's role in it and what that role may do there.
+// Code is blank unless the role has the invite capability.
+type ListedRoom struct {
+	services.Room
+	Role         string                `json:"role"`
+	Capabilities []services.Capability `json:"capabilities"`
 }
 
-func handleCreateRoom(ctx easytcp.Context) {
-	req := ctx.Request()
-
-	// Check authentication
-	if !services.IsAuthenticated(ctx.Session()) {
-		sendRoomError(ctx, "not authenticated")
-		return
-	}
-
-	var createReq CreateRoomRequest
-	if err := json.Unmarshal(req.Data(), &createReq); err != nil {
-		sendRoomError(ctx, "invalid request format")
-		return
-	}
-
-	// Validate required fields
-	if createReq.RoomName == "" {
-		sendRoomError(ctx, "room_name is required")
-		return
-	}
-
-	if createReq.UserID == "" {
-		sendRoomError(ctx, "user_id is required")
-		return
-	}
-
-	// Verify the user_id matches the authenticated session
-	userSession := services.GetSession(ctx.Session())
-	if userSession == nil || userSession.UserID != createReq.UserID {
-		sendRoomError(ctx, "user_id mismatch")
-		return
-	}
+func RegisterRoomRoutes(s *easytcp.Server) {
+	handle(s, 201, Authenticated, handleCreateRoom)
+	handle(s, 210, Authenticated, handleListRooms)
+}
 
+func handleCreateRoom(c *Call, req *CreateRoomRequest) (interface{}, error) {
 	// Create room in database
-	room, err := services.CreateRoom(createReq.UserID, createReq.RoomName, createReq.IsPrivate)
+	room, err := services.CreateRoom(c, c.User.UserID, req.RoomName, req.IsPrivate)
 	if err != nil {
-		log.Printf("failed to create room: %v", err)
-		sendRoomError(ctx, "failed to create room")
-		return
+		return nil, fail(services.CodeInternal, "failed to create room", err)
 	}
 
-	log.Printf("room created: %s (code: %s) by user %s", room.Title, room.Code, room.OwnerID)
+	services.Logf(c, "room created: %s (code: %s) by user %s", room.Title, room.Code, room.OwnerID)
 
-	resp := CreateRoomResponse{
-		Success:   true,
-		Message:   "room created successfully",
+	return CreateRoomResponse{
 		RoomID:    room.ID,
 		RoomCode:  room.Code,
 		RoomName:  room.Title,
 		IsPrivate: room.IsPrivate,
-	}
-
-	respData, _ := json.Marshal(resp)
-	ctx.SetResponseMessage(easytcp.NewMessage(req.ID(), respData))
-}
-
-func sendRoomError(ctx easytcp.Context, msg string) {
-	resp := CreateRoomResponse{Success: false, Message: msg}
-	data, _ := json.Marshal(resp)
-	ctx.SetResponseMessage(easytcp.NewMessage(ctx.Request().ID(), data))
+	}, nil
 }
 
-func handleListRooms(ctx easytcp.Context) {
-	req := ctx.Request()
-
-	if !services.IsAuthenticated(ctx.Session()) {
-		sendListRoomsError(ctx, "not authenticated")
-		return
-	}
-
-	var listReq ListRoomsRequest
-	if err := json.Unmarshal(req.Data(), &listReq); err != nil {
-		sendListRoomsError(ctx, "invalid request format")
-		return
-	}
-
-	if listReq.UserID == "" {
-		sendListRoomsError(ctx, "user_id is required")
-		return
-	}
-
-	userSession := services.GetSession(ctx.Session())
-	if userSession == nil || userSession.UserID != listReq.UserID {
-		sendListRoomsError(ctx, "user_id mismatch")
-		return
-	}
-
-	rooms, err := services.ListRoomsByUser(listReq.UserID)
+func handleListRooms(c *Call, req *ListRoomsRequest) (interface{}, error) {
+	rooms, err := services.ListRoomsByUser(c, c.User.UserID)
 	if err != nil {
-		log.Printf("failed to list rooms: %v", err)
-		sendListRoomsError(ctx, "failed to list rooms")
-		return
+		return nil, fail(services.CodeInternal, "failed to list rooms", err)
 	}
 
-	resp := ListRoomsResponse{
-		Success: true,
-		Message: "rooms fetched",
-		Rooms:   rooms,
+	listed := make([]ListedRoom, 0, len(rooms))
+	for _, room := range rooms {
+		archived := room.ArchivedAt != nil
+		if archived && !req.IncludeArchived {
+			continue
+		}
+		caps := services.RoomCapabilities(room.Role, archived)
+		if !slices.Contains(caps, services.CapInvite) {
+			room.Code = ""
+		}
+		listed = append(listed, ListedRoom{Room: room.Room, Role: room.Role, Capabilities: caps})
 	}
 
-	data, _ := json.Marshal(resp)
-	ctx.SetResponseMessage(easytcp.NewMessage(req.ID(), data))
-}
-
-func sendListRoomsError(ctx easytcp.Context, msg string) {
-	resp := ListRoomsResponse{Success: false, Message: msg}
-	data, _ := json.Marshal(resp)
-	ctx.SetResponseMessage(easytcp.NewMessage(ctx.Request().ID(), data))
+	return ListRoomsResponse{
+		Rooms: listed,
+	}, nil
 }
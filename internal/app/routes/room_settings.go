@@ -0,0 +1,142 @@
+package routes
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"musick-server/internal/app/services"
+
+	"github.com/DarthPestilane/easytcp"
+)
+
+// Room settings limits, in characters.
+const (
+	maxRoomTitleLen       = 64
+	maxRoomDescriptionLen = 500
+	maxRoomTopicLen       = 120
+)
+
+// UpdateRoomSettingsRequest changes a room's settings; omitted fields are kept and
+// an empty description or topic clears it.
+type UpdateRoomSettingsRequest struct {
+	RoomID      string  `json:"room_id"`
+	Title       *string `json:"title"`
+	IsPrivate   *bool   `json:"is_private"`
+	Description *string `json:"description"`
+	Topic       *string `json:"topic"`
+	// Archived makes the room read-only (true) or writable again (false).
+	Archived *bool `json:"archived"`
+}
+
+func (r *UpdateRoomSettingsRequest) Validate() error {
+	if r.RoomID == "" {
+		return invalidField("room_id", "room_id is required")
+	}
+	if r.Title == nil && r.IsPrivate == nil && r.Description == nil && r.Topic == nil && r.Archived == nil {
+		return fail(services.CodeValidationFailed, "at least one of title, is_private, description, topic and archived is required", nil)
+	}
+	if r.Title != nil {
+		title := *r.Title
+		if title == "" || utf8.RuneCountInString(title) > maxRoomTitleLen {
+			return invalidField("title", fmt.Sprintf("title must be 1-%d characters", maxRoomTitleLen))
+		}
+		if strings.TrimSpace(title) != title {
+			return invalidField("title", "title must not start or end with spaces")
+		}
+		if hasControlChars(title, false) {
+			return invalidField("title", "title contains invalid characters")
+		}
+	}
+	if r.Description != nil {
+		if utf8.RuneCountInString(*r.Description) > maxRoomDescriptionLen {
+			return invalidField("description", fmt.Sprintf("description exceeds %d characters", maxRoomDescriptionLen))
+		}
+		if hasControlChars(*r.Description, true) {
+			return invalidField("description", "description contains invalid characters")
+		}
+	}
+	if r.Topic != nil {
+		if utf8.RuneCountInString(*r.Topic) > maxRoomTopicLen {
+			return invalidField("topic", fmt.Sprintf("topic exceeds %d characters", maxRoomTopicLen))
+		}
+		if hasControlChars(*r.Topic, false) {
+			return invalidField("topic", "topic contains invalid characters")
+		}
+	}
+	return nil
+}
+
+type UpdateRoomSettingsResponse struct {
+	Room services.Room `json:"room"`
+	// Changed names the settings that changed; empty when the request changed nothing.
+	Changed []string `json:"changed"`
+}
+
+type DeleteRoomRequest struct {
+	RoomID string `json:"room_id"`
+}
+
+func (r *DeleteRoomRequest) Validate() error {
+	if r.RoomID == "" {
+		return invalidField("room_id", "room_id is required")
+	}
+	return nil
+}
+
+type DeleteRoomResponse struct {
+	RoomID  string `json:"room_id"`
+	Deleted bool   `json:"deleted"`
+}
+
+func RegisterRoomSettingsRoutes(s *easytcp.Server) {
+	handle(s, 204, Authenticated, handleUpdateRoomSettings)
+	handle(s, 205, Authenticated, handleDeleteRoom)
+}
+
+func handleUpdateRoomSettings(c *Call, req *UpdateRoomSettingsRequest) (interface{}, error) {
+	services.Logf(c, "204 update room settings: room=%s by=%s", req.RoomID, c.User.UserID)
+
+	if _, err := requireCapability(c, req.RoomID, services.CapEditSettings); err != nil {
+		return nil, err
+	}
+	room, changed, err := services.UpdateRoomSettings(c, req.RoomID, services.RoomSettings{
+		Title:       req.Title,
+		IsPrivate:   req.IsPrivate,
+		Description: req.Description,
+		Topic:       req.Topic,
+		Archived:    req.Archived,
+	})
+	if err != nil {
+		return nil, storeFailure(err, "failed to update room settings", "room not found")
+	}
+
+	if len(changed) > 0 {
+		// Subscribers include members without the invite capability, so the code stays out.
+		pushed := *room
+		pushed.Code = ""
+		services.BroadcastRoomEvent(req.RoomID, services.EventRoomUpdated, c.User.UserID, UpdateRoomSettingsResponse{
+			Room:    pushed,
+			Changed: changed,
+		})
+	}
+	return UpdateRoomSettingsResponse{Room: *room, Changed: changed}, nil
+}
+
+// handleDeleteRoom deletes the room with its history. Subscribers get a room_deleted
+// event as the room's last push and are unsubscribed in the same step.
+func handleDeleteRoom(c *Call, req *DeleteRoomRequest) (interface{}, error) {
+	services.Logf(c, "205 delete room: room=%s by=%s", req.RoomID, c.User.UserID)
+
+	if _, err := requireCapability(c, req.RoomID, services.CapEditSettings); err != nil {
+		return nil, err
+	}
+	if err := services.DeleteRoom(c, req.RoomID); err != nil {
+		return nil, storeFailure(err, "failed to delete room", "room not found")
+	}
+
+	dropped := services.CloseDeletedRoom(req.RoomID, c.User.UserID)
+	services.Logf(c, "205 delete room: room=%s sessions=%d", req.RoomID, dropped)
+
+	return DeleteRoomResponse{RoomID: req.RoomID, Deleted: true}, nil
+}
@@ -0,0 +1,113 @@
+package routes
+
+import (
+	"musick-server/internal/app/services"
+
+	"github.com/DarthPestilane/easytcp"
+)
+
+type SubscribeRequest struct {
+	RoomID string `json:"room_id"`
+}
+
+func (r *SubscribeRequest) Validate() error {
+	if r.RoomID == "" {
+		return invalidField("room_id", "room_id is required")
+	}
+	return nil
+}
+
+type SubscribeResponse struct {
+	RoomID       string                `json:"room_id"`
+	Role         string                `json:"role,omitempty"`
+	Capabilities []services.Capability `json:"capabilities"`
+	// Seq and Epoch are the resume point for route 330: pushes after this carry seq > Seq.
+	Seq   int64  `json:"seq"`
+	Epoch string `json:"epoch,omitempty"`
+}
+
+func RegisterSubscriptionRoutes(s *easytcp.Server) {
+	handle(s, 220, Authenticated, handleSubscribe)
+	handle(s, 221, Authenticated, handleUnsubscribe)
+}
+
+// requireMember returns the caller's role in the room, or FORBIDDEN if they are not a member.
+func requireMember(c *Call, roomID string) (string, error) {
+	role, member, err := services.GetMembership(c, roomID, c.User.UserID)
+	if err != nil {
+		return "", fail(services.CodeInternal, "failed to check room membership", err)
+	}
+	if !member {
+		return "", fail(services.CodeForbidden, "not a member of this room", nil)
+	}
+	return role, nil
+}
+
+// requireCapability is requireMember plus a capability check on the caller's role.
+func requireCapability(c *Call, roomID string, capability services.Capability) (string, error) {
+	role, err := requireMember(c, roomID)
+	if err != nil {
+		return "", err
+	}
+	if err := checkCapability(c, roomID, role, capability); err != nil {
+		return "", err
+	}
+	return role, nil
+}
+
+// checkCapability returns FORBIDDEN (naming the capability) unless role grants it
+// and the room is not archived, or the capability still applies to archived rooms.
+func checkCapability(c *Call, roomID, role string, capability services.Capability) error {
+	if !services.Can(role, capability) {
+		return fail(services.CodeForbidden, "your room role does not allow this", nil).
+			WithDetails(map[string]interface{}{"capability": capability, "role": role})
+	}
+	if services.AllowedWhenArchived(capability) {
+		return nil
+	}
+	return checkRoomWritable(c, roomID)
+}
+
+// checkRoomWritable returns FORBIDDEN when the room is archived (read-only).
+func checkRoomWritable(c *Call, roomID string) error {
+	archived, err := services.IsRoomArchived(c, roomID)
+	if err != nil {
+		return storeFailure(err, "failed to load room", "room not found")
+	}
+	if archived {
+		return fail(services.CodeForbidden, "room is archived", nil).
+			WithDetails(map[string]interface{}{"archived": true})
+	}
+	return nil
+}
+
+func handleSubscribe(c *Call, req *SubscribeRequest) (interface{}, error) {
+	role, err := requireMember(c, req.RoomID)
+	if err != nil {
+		return nil, err
+	}
+
+	archived, err := services.IsRoomArchived(c, req.RoomID)
+	if err != nil {
+		return nil, storeFailure(err, "failed to load room", "room not found")
+	}
+
+	seq := services.SubscribeRoom(req.RoomID, c.Session())
+	services.Logf(c, "220 subscribe: room=%s user=%s seq=%d", req.RoomID, c.User.UserID, seq)
+
+	return SubscribeResponse{
+		RoomID:       req.RoomID,
+		Role:         role,
+		Capabilities: services.RoomCapabilities(role, archived),
+		Seq:          seq,
+		Epoch:        services.ServerEpoch(),
+	}, nil
+}
+
+// handleUnsubscribe stops live pushes for the room on this connection; membership is unchanged.
+func handleUnsubscribe(c *Call, req *SubscribeRequest) (interface{}, error) {
+	services.RemoveSessionFromRoom(req.RoomID, c.Session())
+	services.Logf(c, "221 unsubscribe: room=%s user=%s", req.RoomID, c.User.UserID)
+
+	return SubscribeResponse{RoomID: req.RoomID}, nil
+}
@@ -0,0 +1,77 @@
+package routes
+
+import (
+	"fmt"
+
+	"musick-server/internal/app/services"
+
+	"github.com/DarthPestilane/easytcp"
+)
+
+type FetchThreadRequest struct {
+	RootID   int64  `json:"root_id"`
+	BeforeID string `json:"before_id"`
+	Limit    int    `json:"limit"`
+}
+
+func (r *FetchThreadRequest) Validate() error {
+	if r.RootID <= 0 {
+		return invalidField("root_id", "root_id is required")
+	}
+	if r.BeforeID != "" {
+		if _, ok := parseMessageID(r.BeforeID); !ok {
+			return invalidField("before_id", "before_id must be a message id")
+		}
+	}
+	return validatePageLimit(r.Limit)
+}
+
+// FetchThreadResponse pages a thread's replies newest-first, like route 310.
+type FetchThreadResponse struct {
+	Root         FetchedMessage   `json:"root"`
+	Replies      []FetchedMessage `json:"replies"`
+	HasMore      bool             `json:"has_more"`
+	NextBeforeID string           `json:"next_before_id,omitempty"`
+}
+
+func RegisterThreadRoutes(s *easytcp.Server) {
+	handle(s, 315, Authenticated, handleFetchThread)
+}
+
+func handleFetchThread(c *Call, req *FetchThreadRequest) (interface{}, error) {
+	root, _, err := loadMessageForCaller(c, req.RootID)
+	if err != nil {
+		return nil, err
+	}
+	if root.ThreadRootID != 0 {
+		// Paging from a reply shows the whole thread it belongs to.
+		if root, _, err = loadMessageForCaller(c, root.ThreadRootID); err != nil {
+			return nil, err
+		}
+	}
+
+	replies, hasMore, err := services.ListMessages(c, services.MessageQuery{
+		RoomID:       root.RoomID,
+		BeforeID:     req.BeforeID,
+		Limit:        req.Limit,
+		ThreadRootID: root.ID,
+	})
+	if err != nil {
+		return nil, fail(services.CodeInternal, "failed to fetch thread", err)
+	}
+
+	page, err := decorateMessages(c, append([]services.Message{*root}, replies...))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := FetchThreadResponse{
+		Root:    page[0],
+		Replies: page[1:],
+		HasMore: hasMore,
+	}
+	if len(replies) > 0 {
+		resp.NextBeforeID = fmt.Sprintf("%d", replies[len(replies)-1].ID)
+	}
+	return resp, nil
+}
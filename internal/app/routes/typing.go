@@ -0,0 +1,42 @@
+package routes
+
+import (
+	"musick-server/internal/app/services"
+
+	"github.com/DarthPestilane/easytcp"
+)
+
+type TypingRequest struct {
+	RoomID string `json:"room_id"`
+	Typing bool   `json:"typing"`
+}
+
+func (r *TypingRequest) Validate() error {
+	if r.RoomID == "" {
+		return invalidField("room_id", "room_id is required")
+	}
+	return nil
+}
+
+type TypingResponse struct {
+	RoomID string `json:"room_id"`
+	Typing bool   `json:"typing"`
+}
+
+func RegisterTypingRoutes(s *easytcp.Server) {
+	handle(s, 320, Authenticated, handleTyping)
+}
+
+// handleTyping announces typing start (typing=true) or stop to the room's other subscribers.
+func handleTyping(c *Call, req *TypingRequest) (interface{}, error) {
+	if _, err := requireCapability(c, req.RoomID, services.CapSend); err != nil {
+		return nil, err
+	}
+	if err := requireNotMuted(c, req.RoomID); err != nil {
+		return nil, err
+	}
+
+	services.SetTyping(c.Session(), req.RoomID, c.User.UserID, c.User.UserName, req.Typing)
+
+	return TypingResponse{RoomID: req.RoomID, Typing: req.Typing}, nil
+}
@@ -20,7 +20,7 @@ func New() *Server {
 	packer := easytcp.NewDefaultPacker()
 
 	// 2. 關鍵修正：將最大封包限制調大至 10MB (預設可能太小導致斷線)
-	packer.MaxDataSize = 10 * 1024 * 1024
+	packer.MaxDataSize = services.MaxPacketSize
 
 	// 3. 將設定好的 packer 傳入 ServerOption
 	srv := easytcp.NewServer(&easytcp.ServerOption{
@@ -31,12 +31,21 @@ func New() *Server {
 	srv.OnSessionCreate = func(sess easytcp.Session) {
 		addr := sess.Conn().RemoteAddr().String()
 		log.Printf("client connected: %s", addr)
+		// Start the session's outbound queue; all writes go through it.
+		services.OpenOutbox(sess)
+		// Enforce the login deadline and per-IP cap on unauthenticated connections.
+		services.GuardNewSession(sess)
 	}
 	srv.OnSessionClose = func(sess easytcp.Session) {
 		addr := sess.Conn().RemoteAddr().String()
 		log.Printf("client disconnected: %s", addr)
+		services.ReleaseLoginGuard(sess)
 		services.RemoveSession(sess)
+		services.RemoveClientInfo(sess)
+		services.ClearTypingForSession(sess)
+		services.PresenceDisconnect(sess)
 		services.RemoveSessionFromAllRooms(sess)
+		services.CloseOutbox(sess)
 	}
 
 	registerRoutes(srv)
@@ -52,10 +61,26 @@ func (s *Server) Run(addr string) error {
 
 // registerRoutes wires all message handlers.
 func registerRoutes(s *easytcp.Server) {
+	// Queue responses on the session's outbox, tag every request with a correlation ID,
+	// then reject unauthenticated calls to protected routes and inject the caller's session.
+	s.Use(routes.OutboxMiddleware, routes.RequestIDMiddleware, routes.AuthMiddleware)
+
 	routes.RegisterEchoRoutes(s)
+	routes.RegisterHelloRoutes(s)
 	routes.RegisterAuthRoutes(s)
 	routes.RegisterRoomRoutes(s)
 	routes.RegisterJoinRoomRoutes(s)
+	routes.RegisterLeaveRoomRoutes(s)
+	routes.RegisterRoomSettingsRoutes(s)
+	routes.RegisterSubscriptionRoutes(s)
+	routes.RegisterResumeRoutes(s)
+	routes.RegisterPresenceRoutes(s)
+	routes.RegisterRoleRoutes(s)
+	routes.RegisterModerationRoutes(s)
 	routes.RegisterMessageRoutes(s)
+	routes.RegisterReactionRoutes(s)
+	routes.RegisterThreadRoutes(s)
+	routes.RegisterTypingRoutes(s)
 	routes.RegisterShazamRoutes(s)
+	routes.RegisterProfileRoutes(s)
 }
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/DarthPestilane/easytcp"
+)
+
+// ErrorCode is the stable, machine-readable outcome of a request. Clients branch
+// on Code; Message is for humans and may be reworded at any time.
+type ErrorCode string
+
+const (
+	CodeOK                 ErrorCode = "OK"
+	CodeInvalidRequest     ErrorCode = "INVALID_REQUEST"   // body is not valid JSON for the route
+	CodeValidationFailed   ErrorCode = "VALIDATION_FAILED" // a field is missing or out of range
+	CodeUnauthenticated    ErrorCode = "UNAUTHENTICATED"   // route needs login
+	CodeAuthFailed         ErrorCode = "AUTH_FAILED"       // token rejected
+	CodeAuthExpired        ErrorCode = "AUTH_EXPIRED"      // token expired, refresh on route 11
+	CodeForbidden          ErrorCode = "FORBIDDEN"         // logged in but not allowed
+	CodeNotFound           ErrorCode = "NOT_FOUND"
+	CodeConflict           ErrorCode = "CONFLICT"
+	CodeRateLimited        ErrorCode = "RATE_LIMITED"
+	CodeLoginTimeout       ErrorCode = "LOGIN_TIMEOUT"
+	CodeTooManyConnections ErrorCode = "TOO_MANY_CONNECTIONS"
+	CodeUpgradeRequired    ErrorCode = "UPGRADE_REQUIRED" // client app version below MIN_CLIENT_VERSION
+	CodeUpstreamError      ErrorCode = "UPSTREAM_ERROR"   // a third-party API failed
+	CodeInternal           ErrorCode = "INTERNAL_ERROR"
+)
+
+// Envelope is the wire shape of every response and server push.
+type Envelope struct {
+	Success   bool                   `json:"success"`
+	Code      ErrorCode              `json:"code"`
+	Message   string                 `json:"message"`
+	RequestID string                 `json:"request_id,omitempty"` // echoes the request's correlation ID
+	Details   map[string]interface{} `json:"details,omitempty"`
+	Data      interface{}            `json:"data,omitempty"`
+	// Seq is the room sequence number of a 302/303 push (see BroadcastSequenced).
+	Seq int64 `json:"seq,omitempty"`
+}
+
+// Success wraps a payload in an OK envelope.
+func Success(data interface{}) Envelope {
+	return Envelope{Success: true, Code: CodeOK, Message: "ok", Data: data}
+}
+
+// Failure builds an error envelope; details may be nil.
+func Failure(code ErrorCode, message string, details map[string]interface{}) Envelope {
+	return Envelope{Success: false, Code: code, Message: message, Details: details}
+}
+
+// NewEnvelopeMessage encodes an envelope as an easytcp message on the given route.
+func NewEnvelopeMessage(route int, env Envelope) *easytcp.Message {
+	data, err := json.Marshal(env)
+	if err != nil {
+		log.Printf("marshal envelope for route %d: %v", route, err)
+		data, _ = json.Marshal(Failure(CodeInternal, "internal error", nil))
+	}
+	return easytcp.NewMessage(route, data)
+}
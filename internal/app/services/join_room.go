@@ -1,82 +1,41 @@
 package services
 
 import (
-	"bytes"
-	"encoding/json"
-	"fmt"
-	"io"
-	"net/http"
-	"time"
+	"context"
+	"errors"
 )
 
-// JoinRoomByCode looks up room by code and inserts membership. Returns room details.
-func JoinRoomByCode(code, userID string) (*Room, error) {
-	loadEnv()
+// ErrRoomArchived is returned when joining a room that has been archived.
+var ErrRoomArchived = errors.New("room is archived")
 
-	// Step 1: find room details by code
-	findReq, _ := http.NewRequest("GET", fmt.Sprintf("%s/rest/v1/rooms?code=eq.%s&select=id,code,owner_id,title,is_private,created_at&limit=1", supabaseURL, code), nil)
-	findReq.Header.Set("Authorization", "Bearer "+supabaseAPIKey)
-	findReq.Header.Set("apikey", supabaseAPIKey)
+// JoinRoomByCode looks up room by code and inserts membership. Returns room details and
+// whether the user was not a member before, or ErrNotFound when no room has that code,
+// ErrRoomArchived or ErrBanned.
+func JoinRoomByCode(ctx context.Context, code, userID string) (*Room, bool, error) {
+	st := currentStore()
 
-	findResp, err := http.DefaultClient.Do(findReq)
+	// Step 1: find room details by code
+	room, err := st.FindRoomByCode(ctx, code)
 	if err != nil {
-		return nil, fmt.Errorf("lookup room by code: %w", err)
-	}
-	defer findResp.Body.Close()
-
-	if findResp.StatusCode != 200 {
-		body, _ := io.ReadAll(findResp.Body)
-		return nil, fmt.Errorf("lookup room failed (status %d): %s", findResp.StatusCode, body)
-	}
-
-	var rooms []struct {
-		ID        string    `json:"id"`
-		Code      string    `json:"code"`
-		OwnerID   string    `json:"owner_id"`
-		Title     string    `json:"title"`
-		IsPrivate bool      `json:"is_private"`
-		CreatedAt time.Time `json:"created_at"`
+		return nil, false, err
 	}
-	if err := json.NewDecoder(findResp.Body).Decode(&rooms); err != nil {
-		return nil, fmt.Errorf("decode room lookup: %w", err)
+	if room.ArchivedAt != nil {
+		return nil, false, ErrRoomArchived
 	}
-	if len(rooms) == 0 {
-		return nil, fmt.Errorf("room not found")
+	banned, err := isBanned(ctx, room.ID, userID)
+	if err != nil {
+		return nil, false, err
 	}
-	room := rooms[0]
-	roomID := room.ID
-
-	// Step 2: insert membership (idempotent upsert on PK room_id+account_id)
-	payload := map[string]interface{}{
-		"room_id":    roomID,
-		"account_id": userID,
-		"role":       "member",
+	if banned {
+		return nil, false, ErrBanned
 	}
-	body, _ := json.Marshal(payload)
-
-	insertReq, _ := http.NewRequest("POST", fmt.Sprintf("%s/rest/v1/room_members", supabaseURL), bytes.NewReader(body))
-	insertReq.Header.Set("Authorization", "Bearer "+supabaseAPIKey)
-	insertReq.Header.Set("apikey", supabaseAPIKey)
-	insertReq.Header.Set("Content-Type", "application/json")
-	insertReq.Header.Set("Prefer", "resolution=ignore-duplicates")
 
-	insertResp, err := http.DefaultClient.Do(insertReq)
+	// Step 2: insert membership (existing members are left untouched)
+	joined, err := st.AddMember(ctx, room.ID, userID, RoleMember)
 	if err != nil {
-		return nil, fmt.Errorf("insert membership: %w", err)
-	}
-	defer insertResp.Body.Close()
-
-	if insertResp.StatusCode != 201 && insertResp.StatusCode != 204 {
-		b, _ := io.ReadAll(insertResp.Body)
-		return nil, fmt.Errorf("insert membership failed (status %d): %s", insertResp.StatusCode, b)
+		return nil, false, err
 	}
+	InvalidateMembership(room.ID, userID)
 
-	return &Room{
-		ID:        room.ID,
-		Code:      room.Code,
-		OwnerID:   room.OwnerID,
-		Title:     room.Title,
-		IsPrivate: room.IsPrivate,
-		CreatedAt: room.CreatedAt,
-	}, nil
+	return room, joined, nil
 }
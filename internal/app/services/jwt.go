@@ -0,0 +1,394 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrTokenInvalid means the token was checked locally and rejected (bad signature, expired, wrong aud/iss).
+	ErrTokenInvalid = errors.New("invalid token")
+	// ErrNoVerificationKey means the token could not be checked locally (no secret/JWKS or unknown key id).
+	ErrNoVerificationKey = errors.New("no verification key")
+)
+
+// TokenClaims are the JWT claims the server relies on.
+type TokenClaims struct {
+	UserID    string
+	Email     string
+	UserName  string
+	ExpiresAt time.Time
+}
+
+// JWTVerifierConfig configures local token verification.
+type JWTVerifierConfig struct {
+	Secret          []byte        // HS256 shared secret (Supabase project JWT secret)
+	JWKSURL         string        // JWKS document for RS256/ES256 keys
+	APIKey          string        // sent as the apikey header on JWKS requests, if set
+	RefreshInterval time.Duration // how often the JWKS document is re-fetched
+	Audience        string        // expected aud; empty skips the check
+	Issuer          string        // expected iss; empty skips the check
+	Leeway          time.Duration // clock skew tolerated for exp/nbf
+	Now             func() time.Time
+	HTTPClient      *http.Client
+}
+
+// JWTVerifier validates Supabase access tokens without calling Supabase Auth.
+type JWTVerifier struct {
+	cfg JWTVerifierConfig
+
+	mu          sync.RWMutex
+	keys        map[string]crypto.PublicKey // kid -> key
+	lastAttempt time.Time
+	fetching    chan struct{} // closed when the on-demand fetch in flight finishes
+	stop        chan struct{}
+}
+
+// jwksMinRefetch limits on-demand JWKS fetches triggered by unknown key ids.
+const jwksMinRefetch = time.Minute
+
+// NewJWTVerifier builds a verifier. When a JWKS URL is set the keys are fetched
+// once immediately and then refreshed every RefreshInterval until Close.
+func NewJWTVerifier(cfg JWTVerifierConfig) *JWTVerifier {
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = time.Hour
+	}
+	v := &JWTVerifier{
+		cfg:  cfg,
+		keys: make(map[string]crypto.PublicKey),
+		stop: make(chan struct{}),
+	}
+	if cfg.JWKSURL != "" {
+		if err := v.refreshJWKS(); err != nil {
+			log.Printf("jwks initial fetch failed: %v", err)
+		}
+		go v.refreshLoop()
+	}
+	return v
+}
+
+// Close stops the background JWKS refresh.
+func (v *JWTVerifier) Close() {
+	select {
+	case <-v.stop:
+	default:
+		close(v.stop)
+	}
+}
+
+// Enabled reports whether any local verification key source is configured.
+func (v *JWTVerifier) Enabled() bool {
+	return len(v.cfg.Secret) > 0 || v.cfg.JWKSURL != ""
+}
+
+func (v *JWTVerifier) refreshLoop() {
+	ticker := time.NewTicker(v.cfg.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-v.stop:
+			return
+		case <-ticker.C:
+			if err := v.refreshJWKS(); err != nil {
+				log.Printf("jwks refresh failed: %v", err)
+			}
+		}
+	}
+}
+
+// Verify checks signature, exp/nbf, aud and iss and returns the user claims.
+func (v *JWTVerifier) Verify(token string) (*TokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrTokenInvalid)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrTokenInvalid, err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature encoding", ErrTokenInvalid)
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+
+	if err := v.verifySignature(header.Alg, header.Kid, signed, sig); err != nil {
+		return nil, err
+	}
+
+	var claims struct {
+		Sub          string                 `json:"sub"`
+		Email        string                 `json:"email"`
+		UserName     string                 `json:"user_name"`
+		UserMetadata map[string]interface{} `json:"user_metadata"`
+		Exp          *json.Number           `json:"exp"`
+		Nbf          *json.Number           `json:"nbf"`
+		Iss          string                 `json:"iss"`
+		Aud          json.RawMessage        `json:"aud"`
+	}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", ErrTokenInvalid, err)
+	}
+
+	now := v.cfg.Now()
+	if claims.Exp == nil {
+		return nil, fmt.Errorf("%w: missing exp", ErrTokenInvalid)
+	}
+	exp, err := numericDate(*claims.Exp)
+	if err != nil {
+		return nil, fmt.Errorf("%w: exp: %v", ErrTokenInvalid, err)
+	}
+	if now.After(exp.Add(v.cfg.Leeway)) {
+		return nil, fmt.Errorf("%w: token expired", ErrTokenInvalid)
+	}
+	if claims.Nbf != nil {
+		nbf, err := numericDate(*claims.Nbf)
+		if err != nil {
+			return nil, fmt.Errorf("%w: nbf: %v", ErrTokenInvalid, err)
+		}
+		if now.Add(v.cfg.Leeway).Before(nbf) {
+			return nil, fmt.Errorf("%w: token not yet valid", ErrTokenInvalid)
+		}
+	}
+	if v.cfg.Issuer != "" && claims.Iss != v.cfg.Issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrTokenInvalid, claims.Iss)
+	}
+	if v.cfg.Audience != "" && !audienceContains(claims.Aud, v.cfg.Audience) {
+		return nil, fmt.Errorf("%w: unexpected audience", ErrTokenInvalid)
+	}
+	if claims.Sub == "" {
+		return nil, fmt.Errorf("%w: missing sub", ErrTokenInvalid)
+	}
+
+	userName := claims.UserName
+	if name, ok := claims.UserMetadata["user_name"].(string); ok && userName == "" {
+		userName = name
+	}
+
+	return &TokenClaims{
+		UserID:    claims.Sub,
+		Email:     claims.Email,
+		UserName:  userName,
+		ExpiresAt: exp,
+	}, nil
+}
+
+func (v *JWTVerifier) verifySignature(alg, kid string, signed, sig []byte) error {
+	switch alg {
+	case "HS256":
+		if len(v.cfg.Secret) == 0 {
+			return fmt.Errorf("%w: HS256 secret not configured", ErrNoVerificationKey)
+		}
+		mac := hmac.New(sha256.New, v.cfg.Secret)
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return fmt.Errorf("%w: signature mismatch", ErrTokenInvalid)
+		}
+		return nil
+	case "RS256", "ES256":
+		key, err := v.lookupKey(kid)
+		if err != nil {
+			return err
+		}
+		digest := sha256.Sum256(signed)
+		switch k := key.(type) {
+		case *rsa.PublicKey:
+			if alg != "RS256" || rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig) != nil {
+				return fmt.Errorf("%w: signature mismatch", ErrTokenInvalid)
+			}
+		case *ecdsa.PublicKey:
+			if alg != "ES256" || len(sig) != 64 {
+				return fmt.Errorf("%w: signature mismatch", ErrTokenInvalid)
+			}
+			r := new(big.Int).SetBytes(sig[:32])
+			s := new(big.Int).SetBytes(sig[32:])
+			if !ecdsa.Verify(k, digest[:], r, s) {
+				return fmt.Errorf("%w: signature mismatch", ErrTokenInvalid)
+			}
+		default:
+			return fmt.Errorf("%w: unsupported key type", ErrTokenInvalid)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: unsupported alg %q", ErrTokenInvalid, alg)
+	}
+}
+
+// lookupKey returns the JWKS key for kid, re-fetching the document (rate limited) when the kid is unknown.
+// Concurrent lookups of unknown kids share one fetch.
+func (v *JWTVerifier) lookupKey(kid string) (crypto.PublicKey, error) {
+	if v.cfg.JWKSURL == "" {
+		return nil, fmt.Errorf("%w: JWKS not configured", ErrNoVerificationKey)
+	}
+	v.mu.RLock()
+	key, ok := v.keys[kid]
+	v.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+	if err := v.refetchForUnknownKid(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoVerificationKey, err)
+	}
+	v.mu.RLock()
+	key, ok = v.keys[kid]
+	v.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: unknown kid %q", ErrNoVerificationKey, kid)
+}
+
+// refetchForUnknownKid waits for the on-demand fetch in flight, or starts one unless
+// the last attempt was within jwksMinRefetch. The attempt is claimed under the write
+// lock so concurrent callers cannot all pass the rate limit.
+func (v *JWTVerifier) refetchForUnknownKid() error {
+	v.mu.Lock()
+	if ch := v.fetching; ch != nil {
+		v.mu.Unlock()
+		<-ch
+		return nil
+	}
+	if v.cfg.Now().Sub(v.lastAttempt) < jwksMinRefetch {
+		v.mu.Unlock()
+		return nil
+	}
+	v.lastAttempt = v.cfg.Now()
+	ch := make(chan struct{})
+	v.fetching = ch
+	v.mu.Unlock()
+
+	err := v.fetchJWKS()
+
+	v.mu.Lock()
+	v.fetching = nil
+	v.mu.Unlock()
+	close(ch)
+	return err
+}
+
+// refreshJWKS records the attempt and fetches the JWKS document.
+func (v *JWTVerifier) refreshJWKS() error {
+	v.mu.Lock()
+	v.lastAttempt = v.cfg.Now()
+	v.mu.Unlock()
+	return v.fetchJWKS()
+}
+
+// fetchJWKS fetches the JWKS document and replaces the key set.
+func (v *JWTVerifier) fetchJWKS() error {
+
+	req, _ := http.NewRequest("GET", v.cfg.JWKSURL, nil)
+	if v.cfg.APIKey != "" {
+		req.Header.Set("apikey", v.cfg.APIKey)
+	}
+	resp, err := v.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetch jwks: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("fetch jwks failed (status %d)", resp.StatusCode)
+	}
+
+	var doc struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Crv string `json:"crv"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return fmt.Errorf("decode jwks: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(doc.Keys))
+	for _, k := range doc.Keys {
+		switch k.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil {
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			if k.Crv != "P-256" {
+				continue
+			}
+			x, errX := base64.RawURLEncoding.DecodeString(k.X)
+			y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+
+	v.mu.Lock()
+	v.keys = keys
+	v.mu.Unlock()
+	return nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(strings.NewReader(string(raw)))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func numericDate(n json.Number) (time.Time, error) {
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(int64(f), 0), nil
+}
+
+// audienceContains accepts aud as a string or an array of strings.
+func audienceContains(raw json.RawMessage, want string) bool {
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		return single == want
+	}
+	var many []string
+	if err := json.Unmarshal(raw, &many); err == nil {
+		for _, a := range many {
+			if a == want {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,353 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	testIssuer   = "https://example.supabase.co/auth/v1"
+	testAudience = "authenticated"
+)
+
+var testNow = time.Unix(1_800_000_000, 0)
+
+// testClaims returns valid claims for testNow; callers override fields per case.
+func testClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"sub":           "user-1",
+		"email":         "alice@example.com",
+		"user_metadata": map[string]interface{}{"user_name": "alice"},
+		"exp":           testNow.Add(time.Hour).Unix(),
+		"iss":           testIssuer,
+		"aud":           testAudience,
+	}
+}
+
+// signToken builds a compact JWT signed with key: a []byte secret for HS256, an
+// *rsa.PrivateKey for RS256, an *ecdsa.PrivateKey for ES256 or nil for alg none.
+func signToken(t *testing.T, alg, kid string, claims map[string]interface{}, key interface{}) string {
+	t.Helper()
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+
+	var sig []byte
+	digest := sha256.Sum256([]byte(signed))
+	switch k := key.(type) {
+	case nil:
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			t.Fatalf("rsa sign: %v", err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatalf("ecdsa sign: %v", err)
+		}
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	default:
+		t.Fatalf("unsupported key type %T", key)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func rsaJWK(kid string, k *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"kid": kid,
+		"n":   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+	}
+}
+
+func ecJWK(kid string, k *ecdsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "EC",
+		"kid": kid,
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(k.X.FillBytes(make([]byte, 32))),
+		"y":   base64.RawURLEncoding.EncodeToString(k.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+// jwksServer serves a replaceable JWKS document and counts fetches.
+type jwksServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	keys    []map[string]string
+	delay   time.Duration
+	apiKeys []string // apikey header of each fetch
+	fetches int32
+}
+
+func newJWKSServer(t *testing.T, keys ...map[string]string) *jwksServer {
+	js := &jwksServer{keys: keys}
+	js.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&js.fetches, 1)
+		js.mu.Lock()
+		defer js.mu.Unlock()
+		js.apiKeys = append(js.apiKeys, r.Header.Get("apikey"))
+		time.Sleep(js.delay)
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": js.keys})
+	}))
+	t.Cleanup(js.Close)
+	return js
+}
+
+func (js *jwksServer) setKeys(keys ...map[string]string) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	js.keys = keys
+}
+
+func (js *jwksServer) setDelay(d time.Duration) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	js.delay = d
+}
+
+func (js *jwksServer) fetchCount() int {
+	return int(atomic.LoadInt32(&js.fetches))
+}
+
+// testClock is a settable Now for the verifier.
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestVerifier(t *testing.T, secret []byte, jwksURL string, now func() time.Time) *JWTVerifier {
+	v := NewJWTVerifier(JWTVerifierConfig{
+		Secret:   secret,
+		JWKSURL:  jwksURL,
+		Audience: testAudience,
+		Issuer:   testIssuer,
+		Now:      now,
+	})
+	t.Cleanup(v.Close)
+	return v
+}
+
+func mustRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate rsa key: %v", err)
+	}
+	return k
+}
+
+func mustECKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ec key: %v", err)
+	}
+	return k
+}
+
+func TestVerifyValidTokens(t *testing.T) {
+	secret := []byte("s3cret")
+	rsaKey := mustRSAKey(t)
+	ecKey := mustECKey(t)
+	js := newJWKSServer(t, rsaJWK("rsa-1", &rsaKey.PublicKey), ecJWK("ec-1", &ecKey.PublicKey))
+	v := newTestVerifier(t, secret, js.URL, func() time.Time { return testNow })
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"HS256", signToken(t, "HS256", "", testClaims(), secret)},
+		{"RS256", signToken(t, "RS256", "rsa-1", testClaims(), rsaKey)},
+		{"ES256", signToken(t, "ES256", "ec-1", testClaims(), ecKey)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := v.Verify(tt.token)
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if claims.UserID != "user-1" || claims.Email != "alice@example.com" || claims.UserName != "alice" {
+				t.Errorf("claims = %+v", claims)
+			}
+			if want := testNow.Add(time.Hour); !claims.ExpiresAt.Equal(want) {
+				t.Errorf("ExpiresAt = %v, want %v", claims.ExpiresAt, want)
+			}
+		})
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	secret := []byte("s3cret")
+	rsaKey := mustRSAKey(t)
+	js := newJWKSServer(t, rsaJWK("rsa-1", &rsaKey.PublicKey))
+	v := newTestVerifier(t, secret, js.URL, func() time.Time { return testNow })
+
+	with := func(key string, value interface{}) map[string]interface{} {
+		c := testClaims()
+		c[key] = value
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"expired", signToken(t, "HS256", "", with("exp", testNow.Add(-time.Minute).Unix()), secret), ErrTokenInvalid},
+		{"wrong audience", signToken(t, "HS256", "", with("aud", "anon"), secret), ErrTokenInvalid},
+		{"wrong issuer", signToken(t, "HS256", "", with("iss", "https://evil.example"), secret), ErrTokenInvalid},
+		{"alg none", signToken(t, "none", "", testClaims(), nil), ErrTokenInvalid},
+		{"wrong secret", signToken(t, "HS256", "", testClaims(), []byte("other")), ErrTokenInvalid},
+		{"wrong kid", signToken(t, "RS256", "rsa-2", testClaims(), rsaKey), ErrNoVerificationKey},
+		{"key of another kid", signToken(t, "RS256", "rsa-1", testClaims(), mustRSAKey(t)), ErrTokenInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := v.Verify(tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify = %+v, %v; want %v", claims, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyRefetchesJWKSForUnknownKid(t *testing.T) {
+	oldKey := mustRSAKey(t)
+	newKey := mustECKey(t)
+	js := newJWKSServer(t, rsaJWK("old", &oldKey.PublicKey))
+	clock := &testClock{now: testNow}
+	v := newTestVerifier(t, nil, js.URL, clock.Now)
+	if got := js.fetchCount(); got != 1 {
+		t.Fatalf("initial fetches = %d, want 1", got)
+	}
+
+	// The key set rotates; a token with the new kid triggers a refetch once the
+	// rate limit from the initial fetch has passed.
+	js.setKeys(rsaJWK("old", &oldKey.PublicKey), ecJWK("new", &newKey.PublicKey))
+	clock.Advance(jwksMinRefetch)
+	if _, err := v.Verify(signToken(t, "ES256", "new", testClaims(), newKey)); err != nil {
+		t.Fatalf("Verify with rotated key: %v", err)
+	}
+	if got := js.fetchCount(); got != 2 {
+		t.Fatalf("fetches after rotation = %d, want 2", got)
+	}
+
+	// Known kids never refetch.
+	if _, err := v.Verify(signToken(t, "RS256", "old", testClaims(), oldKey)); err != nil {
+		t.Fatalf("Verify with old key: %v", err)
+	}
+	if got := js.fetchCount(); got != 2 {
+		t.Fatalf("fetches after known kid = %d, want 2", got)
+	}
+}
+
+func TestVerifyRateLimitsJWKSRefetch(t *testing.T) {
+	key := mustRSAKey(t)
+	js := newJWKSServer(t, rsaJWK("k1", &key.PublicKey))
+	clock := &testClock{now: testNow}
+	v := newTestVerifier(t, nil, js.URL, clock.Now)
+
+	unknown := signToken(t, "RS256", "k2", testClaims(), key)
+	for i := 0; i < 3; i++ {
+		if _, err := v.Verify(unknown); !errors.Is(err, ErrNoVerificationKey) {
+			t.Fatalf("Verify #%d err = %v, want ErrNoVerificationKey", i, err)
+		}
+	}
+	if got := js.fetchCount(); got != 1 {
+		t.Fatalf("fetches within the rate limit = %d, want 1", got)
+	}
+
+	clock.Advance(jwksMinRefetch)
+	if _, err := v.Verify(unknown); !errors.Is(err, ErrNoVerificationKey) {
+		t.Fatalf("Verify after rate limit err = %v, want ErrNoVerificationKey", err)
+	}
+	if got := js.fetchCount(); got != 2 {
+		t.Fatalf("fetches after the rate limit = %d, want 2", got)
+	}
+}
+
+func TestVerifyConcurrentUnknownKidsFetchOnce(t *testing.T) {
+	oldKey := mustRSAKey(t)
+	newKey := mustECKey(t)
+	js := newJWKSServer(t, rsaJWK("old", &oldKey.PublicKey))
+	clock := &testClock{now: testNow}
+	v := newTestVerifier(t, nil, js.URL, clock.Now)
+
+	js.setKeys(ecJWK("new", &newKey.PublicKey))
+	js.setDelay(100 * time.Millisecond)
+	clock.Advance(jwksMinRefetch)
+
+	token := signToken(t, "ES256", "new", testClaims(), newKey)
+	var wg sync.WaitGroup
+	errs := make([]error, 20)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = v.Verify(token)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("Verify #%d: %v", i, err)
+		}
+	}
+	if got := js.fetchCount(); got != 2 {
+		t.Fatalf("fetches = %d, want 2 (initial + one shared refetch)", got)
+	}
+}
+
+func TestJWKSFetchSendsConfiguredAPIKey(t *testing.T) {
+	key := mustRSAKey(t)
+	js := newJWKSServer(t, rsaJWK("k1", &key.PublicKey))
+	v := NewJWTVerifier(JWTVerifierConfig{JWKSURL: js.URL, APIKey: "anon-key"})
+	t.Cleanup(v.Close)
+
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	if len(js.apiKeys) != 1 || js.apiKeys[0] != "anon-key" {
+		t.Fatalf("apikey headers = %q, want [anon-key]", js.apiKeys)
+	}
+}
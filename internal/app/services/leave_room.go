@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"fmt"
+)
+
+// LeaveResult reports what happened to the room when a member left.
+type LeaveResult struct {
+	// NewOwnerID is set when the leaving owner's room was handed to another member.
+	NewOwnerID string
+	// Archived is set when the owner was the last member.
+	Archived bool
+}
+
+// LeaveRoom deletes the user's membership. When the owner leaves, ownership moves
+// to the highest-ranked remaining member (longest-standing first), or the room is
+// archived if nobody is left.
+// Returns ErrNotFound when the user is not a member.
+func LeaveRoom(ctx context.Context, roomID, userID string) (*LeaveResult, error) {
+	st := currentStore()
+
+	role, err := st.GetMemberRole(ctx, roomID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := st.RemoveMember(ctx, roomID, userID); err != nil {
+		return nil, err
+	}
+	InvalidateMembership(roomID, userID)
+
+	res := &LeaveResult{}
+	if role != RoleOwner {
+		return res, nil
+	}
+
+	members, err := st.ListMembers(ctx, roomID)
+	if err != nil {
+		return res, fmt.Errorf("list remaining members: %w", err)
+	}
+	if len(members) == 0 {
+		if err := st.ArchiveRoom(ctx, roomID); err != nil {
+			return res, fmt.Errorf("archive room: %w", err)
+		}
+		invalidateRoom(roomID)
+		res.Archived = true
+		return res, nil
+	}
+
+	// The highest-ranked remaining member takes over; ties go to whoever joined first.
+	next := members[0]
+	for _, m := range members[1:] {
+		if RoleRank(m.Role) > RoleRank(next.Role) {
+			next = m
+		}
+	}
+	if err := st.TransferOwnership(ctx, roomID, next.UserID); err != nil {
+		return res, fmt.Errorf("transfer ownership: %w", err)
+	}
+	InvalidateMembership(roomID, next.UserID)
+	res.NewOwnerID = next.UserID
+	return res, nil
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/DarthPestilane/easytcp"
+)
+
+// ConnectionRejectedRoute is the push route carrying the reason a connection is being closed.
+const ConnectionRejectedRoute = 13
+
+// pendingLogin tracks a connection that has not authenticated yet.
+type pendingLogin struct {
+	ip    string
+	timer *time.Timer
+}
+
+var (
+	pendingLogins   = make(map[interface{}]*pendingLogin)
+	unauthPerIP     = make(map[string]int)
+	pendingLoginsMu sync.Mutex
+
+	loginDeadline  time.Duration
+	maxUnauthPerIP int
+	loginGuardOnce sync.Once
+)
+
+// loadLoginGuard reads LOGIN_DEADLINE (default 30s, 0 disables) and
+// MAX_UNAUTH_PER_IP (default 10, 0 disables).
+func loadLoginGuard() {
+	loginGuardOnce.Do(func() {
+		loginDeadline = envDuration("LOGIN_DEADLINE", 30*time.Second)
+		maxUnauthPerIP = envInt("MAX_UNAUTH_PER_IP", 10)
+	})
+}
+
+// GuardNewSession registers a fresh connection as unauthenticated. It returns false
+// (after notifying and closing the session) when the remote IP already holds too many
+// unauthenticated connections; otherwise it arms the login deadline.
+func GuardNewSession(sess easytcp.Session) bool {
+	loadLoginGuard()
+
+	ip := remoteIP(sess)
+
+	pendingLoginsMu.Lock()
+	if maxUnauthPerIP > 0 && unauthPerIP[ip] >= maxUnauthPerIP {
+		pendingLoginsMu.Unlock()
+		log.Printf("rejecting %s: too many unauthenticated connections", ip)
+		rejectSession(sess, CodeTooManyConnections, "too many unauthenticated connections from this address")
+		return false
+	}
+	p := &pendingLogin{ip: ip}
+	unauthPerIP[ip]++
+	pendingLogins[sess.ID()] = p
+	if loginDeadline > 0 {
+		p.timer = time.AfterFunc(loginDeadline, func() {
+			if !releasePendingLogin(sess) {
+				return
+			}
+			log.Printf("closing %s: login deadline of %s exceeded", ip, loginDeadline)
+			rejectSession(sess, CodeLoginTimeout, "login deadline exceeded")
+		})
+	}
+	pendingLoginsMu.Unlock()
+	return true
+}
+
+// ReleaseLoginGuard stops tracking a connection as unauthenticated (on login or close).
+func ReleaseLoginGuard(sess easytcp.Session) {
+	releasePendingLogin(sess)
+}
+
+// releasePendingLogin removes the pending entry; returns false if it was already gone.
+func releasePendingLogin(sess easytcp.Session) bool {
+	pendingLoginsMu.Lock()
+	defer pendingLoginsMu.Unlock()
+	p, ok := pendingLogins[sess.ID()]
+	if !ok {
+		return false
+	}
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	delete(pendingLogins, sess.ID())
+	if unauthPerIP[p.ip]--; unauthPerIP[p.ip] <= 0 {
+		delete(unauthPerIP, p.ip)
+	}
+	return true
+}
+
+// rejectSession pushes a structured error and closes the connection.
+func rejectSession(sess easytcp.Session, code ErrorCode, message string) {
+	SendAndClose(sess, NewEnvelopeMessage(ConnectionRejectedRoute, Failure(code, message, nil)))
+}
+
+func remoteIP(sess easytcp.Session) string {
+	addr := sess.Conn().RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
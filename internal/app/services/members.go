@@ -0,0 +1,30 @@
+package services
+
+import "context"
+
+// RoomMember is a membership joined with the member's display name and live presence.
+type RoomMember struct {
+	Member
+	UserName string
+	Presence Presence
+}
+
+// ListRoomMembers returns the room's members with their role, name and presence.
+func ListRoomMembers(ctx context.Context, roomID string) ([]RoomMember, error) {
+	members, err := currentStore().ListMembers(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(members))
+	for i, m := range members {
+		ids[i] = m.UserID
+	}
+	names := UserNames(ctx, ids)
+
+	out := make([]RoomMember, 0, len(members))
+	for _, m := range members {
+		out = append(out, RoomMember{Member: m, UserName: names[m.UserID], Presence: GetPresence(m.UserID)})
+	}
+	return out, nil
+}
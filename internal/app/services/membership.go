@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// membershipEntry caches one (room, user) lookup, including negative results.
+type membershipEntry struct {
+	role    string
+	member  bool
+	expires time.Time
+}
+
+var (
+	membershipCache   = make(map[string]membershipEntry)
+	membershipCacheMu sync.RWMutex
+
+	membershipTTL     time.Duration
+	nonMemberTTL      time.Duration
+	membershipEnvOnce sync.Once
+)
+
+// loadMembershipEnv reads MEMBERSHIP_CACHE_TTL (default 5m) and
+// NON_MEMBER_CACHE_TTL (default 30s, kept short so fresh joins are seen quickly
+// even when invalidation happened on another server).
+func loadMembershipEnv() {
+	membershipEnvOnce.Do(func() {
+		membershipTTL = envDuration("MEMBERSHIP_CACHE_TTL", 5*time.Minute)
+		nonMemberTTL = envDuration("NON_MEMBER_CACHE_TTL", 30*time.Second)
+	})
+}
+
+func membershipKey(roomID, userID string) string {
+	return roomID + "|" + userID
+}
+
+// GetMembership returns the user's role in the room and whether they are a member,
+// serving from the cache when possible.
+func GetMembership(ctx context.Context, roomID, userID string) (string, bool, error) {
+	loadMembershipEnv()
+	key := membershipKey(roomID, userID)
+
+	membershipCacheMu.RLock()
+	e, ok := membershipCache[key]
+	membershipCacheMu.RUnlock()
+	if ok && time.Now().Before(e.expires) {
+		return e.role, e.member, nil
+	}
+
+	role, err := currentStore().GetMemberRole(ctx, roomID, userID)
+	member := err == nil
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return "", false, err
+	}
+
+	ttl := membershipTTL
+	if !member {
+		ttl = nonMemberTTL
+	}
+	membershipCacheMu.Lock()
+	membershipCache[key] = membershipEntry{role: role, member: member, expires: time.Now().Add(ttl)}
+	membershipCacheMu.Unlock()
+	return role, member, nil
+}
+
+// IsMember reports whether the user belongs to the room.
+func IsMember(ctx context.Context, roomID, userID string) (bool, error) {
+	_, member, err := GetMembership(ctx, roomID, userID)
+	return member, err
+}
+
+// InvalidateMembership drops the cached entry after a join, leave or role change.
+func InvalidateMembership(roomID, userID string) {
+	membershipCacheMu.Lock()
+	defer membershipCacheMu.Unlock()
+	delete(membershipCache, membershipKey(roomID, userID))
+}
+
+// invalidateRoomMemberships drops every cached lookup for the room, members and
+// non-members alike.
+func invalidateRoomMemberships(roomID string) {
+	prefix := membershipKey(roomID, "")
+	membershipCacheMu.Lock()
+	defer membershipCacheMu.Unlock()
+	for key := range membershipCache {
+		if strings.HasPrefix(key, prefix) {
+			delete(membershipCache, key)
+		}
+	}
+}
@@ -1,187 +1,334 @@
 package services
 
 import (
-	"bytes"
-	"encoding/json"
-	"fmt"
-	"io"
-	"net/http"
-	"net/url"
+	"context"
+	"errors"
+	"hash/fnv"
+	"slices"
+	"strconv"
+	"sync"
 	"time"
 )
 
 type Message struct {
-	ID         int64     `json:"id"`
-	RoomID     string    `json:"room_id"`
-	SenderID   string    `json:"sender_id"`
-	SenderName string    `json:"sender_name,omitempty"`
-	Body       string    `json:"body"`
-	Type       string    `json:"type"`
-	SentAt     time.Time `json:"sent_at"`
+	ID         int64      `json:"id"`
+	RoomID     string     `json:"room_id"`
+	SenderID   string     `json:"sender_id"`
+	SenderName string     `json:"sender_name,omitempty"`
+	Body       string     `json:"body"`
+	Type       string     `json:"type"`
+	SentAt     time.Time  `json:"sent_at"`
+	EditedAt   *time.Time `json:"edited_at,omitempty"`
+	// DeletedAt marks a tombstone: the row stays in history with an empty body.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// ReplyToID quotes another message in the same room; 0 when not a reply.
+	ReplyToID int64 `json:"reply_to_id,omitempty"`
+	// ThreadRootID puts the message in a thread under that root; 0 for the main timeline.
+	ThreadRootID int64 `json:"thread_root_id,omitempty"`
+	// ClientMsgID is the sender's own ID for the message, used to deduplicate retries.
+	ClientMsgID string `json:"client_msg_id,omitempty"`
 }
 
-// CreateMessage inserts a new message into Supabase messages table.
-func CreateMessage(roomID, senderID, senderName, body string) (*Message, error) {
-	loadEnv()
+// MessageQuery selects a page of a room's messages. BeforeID and BeforeCreatedAt page
+// backwards from a cursor; AfterID pages forwards and flips the store's order to
+// oldest-first. Callers set at most one cursor.
+type MessageQuery struct {
+	RoomID          string
+	BeforeID        string
+	AfterID         int64
+	BeforeCreatedAt time.Time
+	Limit           int
+	IncludeSystem   bool
+	// ThreadRootID pages through one thread's replies; 0 selects the main timeline,
+	// which leaves thread replies out.
+	ThreadRootID int64
+}
+
+// MessagePreview is the compact form of a replied-to message shown with its reply.
+type MessagePreview struct {
+	ID         int64  `json:"id"`
+	SenderID   string `json:"sender_id"`
+	SenderName string `json:"sender_name,omitempty"`
+	Body       string `json:"body"`
+	Deleted    bool   `json:"deleted,omitempty"`
+}
+
+// previewLength caps the body of a MessagePreview, in characters.
+const previewLength = 100
+
+var (
+	// sendLocks serialize sends that share a (sender, client_msg_id) key so concurrent
+	// retries cannot both miss the dedupe lookup. Keys are striped over a fixed set.
+	sendLocks [64]sync.Mutex
+
+	dedupeWindow  time.Duration
+	dedupeEnvOnce sync.Once
+)
 
-	payload := map[string]interface{}{
-		"room_id":   roomID,
-		"sender_id": senderID,
-		"body":      body,
+// loadDedupeEnv reads MESSAGE_DEDUPE_WINDOW (default 24h): how long a client_msg_id
+// keeps mapping to the message it first created.
+func loadDedupeEnv() {
+	dedupeEnvOnce.Do(func() {
+		dedupeWindow = envDuration("MESSAGE_DEDUPE_WINDOW", 24*time.Hour)
+	})
+}
+
+func sendLock(senderID, clientMsgID string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(senderID))
+	h.Write([]byte{0})
+	h.Write([]byte(clientMsgID))
+	return &sendLocks[h.Sum32()%uint32(len(sendLocks))]
+}
+
+// CreateMessage stores a new text message from draft (RoomID, SenderID, Body and
+// optional ReplyToID/ThreadRootID/ClientMsgID); references must already be checked.
+// The sender's profile name is used, falling back to draft.SenderName.
+// When the sender already used draft.ClientMsgID within MESSAGE_DEDUPE_WINDOW,
+// nothing is inserted: the original message is returned with created=false.
+func CreateMessage(ctx context.Context, draft *Message) (msg *Message, created bool, err error) {
+	st := currentStore()
+	if draft.ClientMsgID != "" {
+		loadDedupeEnv()
+		mu := sendLock(draft.SenderID, draft.ClientMsgID)
+		mu.Lock()
+		defer mu.Unlock()
+
+		prev, err := st.FindMessageByClientID(ctx, draft.SenderID, draft.ClientMsgID, time.Now().Add(-dedupeWindow))
+		if err == nil {
+			prev.SenderName = DisplayName(ctx, prev.SenderID, draft.SenderName)
+			return prev, false, nil
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return nil, false, err
+		}
 	}
 
-	b, err := json.Marshal(payload)
+	msg, err = st.CreateMessage(ctx, draft)
 	if err != nil {
-		return nil, fmt.Errorf("marshal message payload: %w", err)
+		return nil, false, err
 	}
+	msg.SenderName = DisplayName(ctx, msg.SenderID, draft.SenderName)
+	return msg, true, nil
+}
 
-	req, _ := http.NewRequest("POST", supabaseURL+"/rest/v1/messages", bytes.NewReader(b))
-	req.Header.Set("Authorization", "Bearer "+supabaseAPIKey)
-	req.Header.Set("apikey", supabaseAPIKey)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Prefer", "return=representation")
-
-	resp, err := http.DefaultClient.Do(req)
+// GetMessage returns a message with its sender's name, or ErrNotFound.
+func GetMessage(ctx context.Context, id int64) (*Message, error) {
+	msg, err := currentStore().GetMessage(ctx, id)
 	if err != nil {
-		return nil, fmt.Errorf("send message: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
+	if p, err := GetProfile(ctx, msg.SenderID); err == nil {
+		msg.SenderName = p.UserName
+	}
+	return msg, nil
+}
 
-	if resp.StatusCode != 201 { // 201 Created expected with return=representation
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("supabase message insert failed (status %d): %s", resp.StatusCode, bodyBytes)
+// EditMessage replaces a message body; the caller checks who may edit.
+func EditMessage(ctx context.Context, id int64, body, senderName string) (*Message, error) {
+	msg, err := currentStore().EditMessage(ctx, id, body)
+	if err != nil {
+		return nil, err
 	}
+	msg.SenderName = senderName
+	return msg, nil
+}
 
-	var rows []Message
-	if err := json.NewDecoder(resp.Body).Decode(&rows); err != nil {
-		return nil, fmt.Errorf("decode message response: %w", err)
+// DeleteMessage tombstones a message; the caller checks who may delete.
+func DeleteMessage(ctx context.Context, id int64) (*Message, error) {
+	msg, err := currentStore().DeleteMessage(ctx, id)
+	if err != nil {
+		return nil, err
 	}
-	if len(rows) == 0 {
-		return nil, fmt.Errorf("message insert returned no rows")
+	if p, err := GetProfile(ctx, msg.SenderID); err == nil {
+		msg.SenderName = p.UserName
 	}
-
-	msg := rows[0]
-	msg.SenderName = senderName
-	return &msg, nil
+	return msg, nil
 }
 
-// ListMessages returns messages for a room ordered newest-first, with optional before-id pagination.
-func ListMessages(roomID, beforeID string, limit int, includeSystem bool) ([]Message, bool, error) {
-	loadEnv()
+// MessagePage is a window of history, newest first, with whether older (HasBefore)
+// and newer (HasAfter) messages exist outside it.
+type MessagePage struct {
+	Messages  []Message
+	HasBefore bool
+	HasAfter  bool
+}
 
+// clampLimit applies the default (50) and maximum (200) page size.
+func clampLimit(limit int) int {
 	if limit <= 0 {
-		limit = 50
+		return 50
 	}
 	if limit > 200 {
-		limit = 200
-	}
-
-	q := url.Values{}
-	q.Set("room_id", "eq."+roomID)
-	q.Set("select", "id,room_id,sender_id,body,type,sent_at")
-	q.Set("order", "sent_at.desc,id.desc")
-	q.Set("limit", fmt.Sprintf("%d", limit+1))
-	if beforeID != "" {
-		q.Set("id", "lt."+beforeID)
-	}
-	if !includeSystem {
-		q.Set("type", "eq.text")
+		return 200
 	}
+	return limit
+}
 
-	endpoint := fmt.Sprintf("%s/rest/v1/messages?%s", supabaseURL, q.Encode())
-	req, _ := http.NewRequest("GET", endpoint, nil)
-	req.Header.Set("Authorization", "Bearer "+supabaseAPIKey)
-	req.Header.Set("apikey", supabaseAPIKey)
-
-	resp, err := http.DefaultClient.Do(req)
+// ListMessages returns one page of q with sender names filled in, and whether more
+// messages lie past it in the paging direction. The page is newest-first when paging
+// back from BeforeID or BeforeCreatedAt (or from the latest message with no cursor)
+// and oldest-first after AfterID. ThreadRootID limits it to one thread's replies.
+// Pages centred on a message go through PageMessages.
+func ListMessages(ctx context.Context, q MessageQuery) ([]Message, bool, error) {
+	q.Limit = clampLimit(q.Limit)
+	msgs, hasMore, err := listPage(ctx, q)
 	if err != nil {
-		return nil, false, fmt.Errorf("fetch messages: %w", err)
+		return nil, false, err
 	}
-	defer resp.Body.Close()
+	fillSenderNames(ctx, msgs)
+	return msgs, hasMore, nil
+}
 
-	if resp.StatusCode != 200 {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, false, fmt.Errorf("fetch messages failed (status %d): %s", resp.StatusCode, bodyBytes)
-	}
+// PageMessages returns one page of q's timeline with accurate flags on both sides.
+// A non-zero aroundID centres the page on that message: it is included along with
+// up to half the limit of newer messages, the rest being older ones. Otherwise q's
+// cursor picks the direction (AfterID forwards, BeforeID/BeforeCreatedAt or none backwards).
+func PageMessages(ctx context.Context, q MessageQuery, aroundID int64) (*MessagePage, error) {
+	q.Limit = clampLimit(q.Limit)
+	page := &MessagePage{}
 
-	var rows []struct {
-		ID       int64     `json:"id"`
-		RoomID   string    `json:"room_id"`
-		SenderID string    `json:"sender_id"`
-		Body     string    `json:"body"`
-		Type     string    `json:"type"`
-		SentAt   time.Time `json:"sent_at"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&rows); err != nil {
-		return nil, false, fmt.Errorf("decode messages: %w", err)
-	}
+	switch {
+	case aroundID != 0:
+		older := q
+		older.BeforeID = strconv.FormatInt(aroundID+1, 10)
+		older.Limit = q.Limit - q.Limit/2
+		olderMsgs, hasBefore, err := listPage(ctx, older)
+		if err != nil {
+			return nil, err
+		}
+		newer := q
+		newer.AfterID = aroundID
+		newer.Limit = q.Limit / 2
+		newerMsgs, hasAfter, err := listPage(ctx, newer)
+		if err != nil {
+			return nil, err
+		}
+		slices.Reverse(newerMsgs)
+		page.Messages = append(newerMsgs, olderMsgs...)
+		page.HasBefore, page.HasAfter = hasBefore, hasAfter
 
-	msgs := make([]Message, 0, len(rows))
-	nameCache := make(map[string]string)
-	for _, r := range rows {
-		m := Message{
-			ID:       r.ID,
-			RoomID:   r.RoomID,
-			SenderID: r.SenderID,
-			Body:     r.Body,
-			Type:     r.Type,
-			SentAt:   r.SentAt,
+	case q.AfterID != 0:
+		msgs, hasAfter, err := listPage(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		// Anything older than the page's first message (or, for an empty page,
+		// anything at all) lies before it.
+		probe := q
+		probe.AfterID = 0
+		if len(msgs) > 0 {
+			probe.BeforeID = strconv.FormatInt(msgs[0].ID, 10)
+		}
+		if page.HasBefore, err = hasMessages(ctx, probe); err != nil {
+			return nil, err
 		}
+		slices.Reverse(msgs)
+		page.Messages, page.HasAfter = msgs, hasAfter
 
-		if cached, ok := nameCache[r.SenderID]; ok {
-			m.SenderName = cached
-		} else {
-			if name, err := fetchSenderName(r.SenderID); err == nil {
-				m.SenderName = name
-				nameCache[r.SenderID] = name
+	default:
+		msgs, hasBefore, err := listPage(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		// Without a cursor this is the latest page; otherwise look past its newest message.
+		if q.BeforeID != "" || !q.BeforeCreatedAt.IsZero() {
+			probe := q
+			probe.BeforeID, probe.BeforeCreatedAt = "", time.Time{}
+			if len(msgs) > 0 {
+				probe.AfterID = msgs[0].ID
+			}
+			if page.HasAfter, err = hasMessages(ctx, probe); err != nil {
+				return nil, err
 			}
 		}
-		msgs = append(msgs, m)
+		page.Messages, page.HasBefore = msgs, hasBefore
 	}
 
-	hasMore := false
-	if len(msgs) > limit {
-		hasMore = true
-		msgs = msgs[:limit]
+	fillSenderNames(ctx, page.Messages)
+	return page, nil
+}
+
+// listPage runs q against the store and trims the extra row used to detect more.
+func listPage(ctx context.Context, q MessageQuery) ([]Message, bool, error) {
+	msgs, err := currentStore().ListMessages(ctx, q)
+	if err != nil {
+		return nil, false, err
 	}
+	if len(msgs) > q.Limit {
+		return msgs[:q.Limit], true, nil
+	}
+	return msgs, false, nil
+}
 
-	return msgs, hasMore, nil
+// hasMessages reports whether q matches at least one message.
+func hasMessages(ctx context.Context, q MessageQuery) (bool, error) {
+	q.Limit = 0
+	msgs, err := currentStore().ListMessages(ctx, q)
+	return len(msgs) > 0, err
 }
 
-// fetchSenderName gets user_name from auth admin endpoint using service key.
-func fetchSenderName(userID string) (string, error) {
-	if supabaseAPIKey == "" || supabaseURL == "" {
-		return "", fmt.Errorf("supabase config missing")
+// ReplyPreviews returns previews of the messages that msgs reply to, keyed by ID.
+// Replied-to messages that no longer exist are left out.
+func ReplyPreviews(ctx context.Context, msgs []Message) (map[int64]MessagePreview, error) {
+	seen := make(map[int64]bool)
+	ids := make([]int64, 0)
+	for _, m := range msgs {
+		if m.ReplyToID != 0 && !seen[m.ReplyToID] {
+			seen[m.ReplyToID] = true
+			ids = append(ids, m.ReplyToID)
+		}
+	}
+	previews := make(map[int64]MessagePreview, len(ids))
+	if len(ids) == 0 {
+		return previews, nil
 	}
-	endpoint := fmt.Sprintf("%s/auth/v1/admin/users/%s", supabaseURL, userID)
-	req, _ := http.NewRequest("GET", endpoint, nil)
-	req.Header.Set("Authorization", "Bearer "+supabaseAPIKey)
-	req.Header.Set("apikey", supabaseAPIKey)
 
-	resp, err := http.DefaultClient.Do(req)
+	targets, err := currentStore().GetMessages(ctx, ids)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("fetch user failed status %d: %s", resp.StatusCode, bodyBytes)
+	fillSenderNames(ctx, targets)
+	for _, t := range targets {
+		previews[t.ID] = PreviewOf(t)
 	}
+	return previews, nil
+}
 
-	var user struct {
-		UserMetadata map[string]interface{} `json:"user_metadata"`
-		RawMeta      map[string]interface{} `json:"raw_user_meta_data"`
+// PreviewOf builds the compact preview of m.
+func PreviewOf(m Message) MessagePreview {
+	p := MessagePreview{ID: m.ID, SenderID: m.SenderID, SenderName: m.SenderName}
+	if m.DeletedAt != nil {
+		p.Deleted = true
+		return p
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
-		return "", err
+	body := []rune(m.Body)
+	if len(body) > previewLength {
+		p.Body = string(body[:previewLength]) + "…"
+	} else {
+		p.Body = m.Body
 	}
+	return p
+}
 
-	if name, ok := user.UserMetadata["user_name"].(string); ok {
-		return name, nil
+// CountReplies returns live thread reply counts for the given root messages.
+func CountReplies(ctx context.Context, rootIDs []int64) (map[int64]int, error) {
+	return currentStore().CountReplies(ctx, rootIDs)
+}
+
+// fillSenderNames resolves sender names with one batched, cached profile lookup.
+func fillSenderNames(ctx context.Context, msgs []Message) {
+	if len(msgs) == 0 {
+		return
+	}
+	ids := make([]string, len(msgs))
+	for i, m := range msgs {
+		ids[i] = m.SenderID
 	}
-	if name, ok := user.RawMeta["user_name"].(string); ok {
-		return name, nil
+	names := UserNames(ctx, ids)
+	for i := range msgs {
+		if name, ok := names[msgs[i].SenderID]; ok {
+			msgs[i].SenderName = name
+		}
 	}
-	return "", nil
 }
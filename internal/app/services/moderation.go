@@ -0,0 +1,220 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrBanned is returned when a banned user tries to join the room.
+var ErrBanned = errors.New("banned from room")
+
+// Sanction kinds stored in room_sanctions.kind.
+const (
+	SanctionBan  = "ban"
+	SanctionMute = "mute"
+)
+
+// Moderation actions recorded in the moderation log.
+const (
+	ModKick   = "kick"
+	ModBan    = "ban"
+	ModUnban  = "unban"
+	ModMute   = "mute"
+	ModUnmute = "unmute"
+)
+
+// Sanction is a ban or mute on a user in one room. A nil ExpiresAt never expires.
+type Sanction struct {
+	RoomID    string     `json:"room_id"`
+	UserID    string     `json:"account_id"`
+	Kind      string     `json:"kind"`
+	Reason    string     `json:"reason"`
+	CreatedBy string     `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// Active reports whether the sanction is still in force at now.
+func (s *Sanction) Active(now time.Time) bool {
+	return s.ExpiresAt == nil || now.Before(*s.ExpiresAt)
+}
+
+// ModerationEntry is one row of a room's moderation log.
+type ModerationEntry struct {
+	ID        int64      `json:"id"`
+	RoomID    string     `json:"room_id"`
+	Action    string     `json:"action"`
+	TargetID  string     `json:"target_id"`
+	ActorID   string     `json:"actor_id"`
+	Reason    string     `json:"reason"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// muteEntry caches one (room, user) mute lookup; sanction is nil when not muted.
+type muteEntry struct {
+	sanction *Sanction
+	expires  time.Time
+}
+
+var (
+	muteCache   = make(map[string]muteEntry)
+	muteCacheMu sync.RWMutex
+)
+
+// ActiveMute returns the user's mute in the room, or nil when they may send. Lookups
+// are cached like memberships (MEMBERSHIP_CACHE_TTL) since every send checks them.
+func ActiveMute(ctx context.Context, roomID, userID string) (*Sanction, error) {
+	loadMembershipEnv()
+	key := membershipKey(roomID, userID)
+	now := time.Now()
+
+	muteCacheMu.RLock()
+	e, ok := muteCache[key]
+	muteCacheMu.RUnlock()
+	if !ok || !now.Before(e.expires) {
+		s, err := currentStore().GetSanction(ctx, roomID, userID, SanctionMute)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+		e = muteEntry{sanction: s, expires: now.Add(membershipTTL)}
+		muteCacheMu.Lock()
+		muteCache[key] = e
+		muteCacheMu.Unlock()
+	}
+	if e.sanction == nil || !e.sanction.Active(now) {
+		return nil, nil
+	}
+	return e.sanction, nil
+}
+
+func invalidateMute(roomID, userID string) {
+	muteCacheMu.Lock()
+	defer muteCacheMu.Unlock()
+	delete(muteCache, membershipKey(roomID, userID))
+}
+
+// invalidateRoomMutes drops every cached mute lookup for the room.
+func invalidateRoomMutes(roomID string) {
+	prefix := membershipKey(roomID, "")
+	muteCacheMu.Lock()
+	defer muteCacheMu.Unlock()
+	for key := range muteCache {
+		if strings.HasPrefix(key, prefix) {
+			delete(muteCache, key)
+		}
+	}
+}
+
+// isBanned reports whether an unexpired ban keeps the user out of the room.
+func isBanned(ctx context.Context, roomID, userID string) (bool, error) {
+	s, err := currentStore().GetSanction(ctx, roomID, userID, SanctionBan)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return s.Active(time.Now()), nil
+}
+
+// KickMember removes the user's membership; they may rejoin with the room code.
+// Returns ErrNotFound when the user is not a member.
+func KickMember(ctx context.Context, roomID, userID, actorID, reason string) (*ModerationEntry, error) {
+	if err := currentStore().RemoveMember(ctx, roomID, userID); err != nil {
+		return nil, err
+	}
+	InvalidateMembership(roomID, userID)
+	return recordModeration(ctx, &ModerationEntry{RoomID: roomID, Action: ModKick, TargetID: userID, ActorID: actorID, Reason: reason})
+}
+
+// BanMember bans the user from rejoining and removes their membership if they have one.
+// Banning an existing ban replaces its reason. The steps run in an order that is safe to
+// repeat: the ban is upserted first (so a failure after it still keeps the user out),
+// then the membership is removed (already gone is fine), then the log entry is added.
+// After a failure the caller retries the ban to complete it.
+func BanMember(ctx context.Context, roomID, userID, actorID, reason string) (*ModerationEntry, error) {
+	st := currentStore()
+	if err := st.PutSanction(ctx, &Sanction{
+		RoomID: roomID, UserID: userID, Kind: SanctionBan, Reason: reason, CreatedBy: actorID, CreatedAt: time.Now().UTC(),
+	}); err != nil {
+		return nil, fmt.Errorf("store ban: %w", err)
+	}
+	if err := st.RemoveMember(ctx, roomID, userID); err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("remove banned member: %w", err)
+	}
+	InvalidateMembership(roomID, userID)
+	return recordModeration(ctx, &ModerationEntry{RoomID: roomID, Action: ModBan, TargetID: userID, ActorID: actorID, Reason: reason})
+}
+
+// UnbanMember lifts the user's ban; ErrNotFound if they were not banned.
+func UnbanMember(ctx context.Context, roomID, userID, actorID, reason string) (*ModerationEntry, error) {
+	removed, err := currentStore().DeleteSanction(ctx, roomID, userID, SanctionBan)
+	if err != nil {
+		return nil, err
+	}
+	if !removed {
+		return nil, ErrNotFound
+	}
+	return recordModeration(ctx, &ModerationEntry{RoomID: roomID, Action: ModUnban, TargetID: userID, ActorID: actorID, Reason: reason})
+}
+
+// MuteMember stops the user sending messages in the room until the given time,
+// replacing any earlier mute.
+func MuteMember(ctx context.Context, roomID, userID, actorID, reason string, until time.Time) (*ModerationEntry, error) {
+	until = until.UTC()
+	if err := currentStore().PutSanction(ctx, &Sanction{
+		RoomID: roomID, UserID: userID, Kind: SanctionMute, Reason: reason, CreatedBy: actorID,
+		CreatedAt: time.Now().UTC(), ExpiresAt: &until,
+	}); err != nil {
+		return nil, err
+	}
+	invalidateMute(roomID, userID)
+	return recordModeration(ctx, &ModerationEntry{
+		RoomID: roomID, Action: ModMute, TargetID: userID, ActorID: actorID, Reason: reason, ExpiresAt: &until,
+	})
+}
+
+// UnmuteMember lifts the user's mute early; ErrNotFound if they were not muted.
+func UnmuteMember(ctx context.Context, roomID, userID, actorID, reason string) (*ModerationEntry, error) {
+	removed, err := currentStore().DeleteSanction(ctx, roomID, userID, SanctionMute)
+	if err != nil {
+		return nil, err
+	}
+	invalidateMute(roomID, userID)
+	if !removed {
+		return nil, ErrNotFound
+	}
+	return recordModeration(ctx, &ModerationEntry{RoomID: roomID, Action: ModUnmute, TargetID: userID, ActorID: actorID, Reason: reason})
+}
+
+// recordModeration appends the action to the room's moderation log. The action has
+// already taken effect when the write fails; the error is returned so the entry is
+// never announced without being saved.
+func recordModeration(ctx context.Context, e *ModerationEntry) (*ModerationEntry, error) {
+	e.CreatedAt = time.Now().UTC()
+	saved, err := currentStore().AddModerationEntry(ctx, e)
+	if err != nil {
+		return nil, fmt.Errorf("record moderation %s of %s: %w", e.Action, e.TargetID, err)
+	}
+	return saved, nil
+}
+
+// ListModerationLog returns a page of the room's moderation log newest-first, with
+// optional before-id pagination, and whether older entries exist.
+func ListModerationLog(ctx context.Context, roomID string, beforeID int64, limit int) ([]ModerationEntry, bool, error) {
+	limit = clampLimit(limit)
+	entries, err := currentStore().ListModerationLog(ctx, roomID, beforeID, limit)
+	if err != nil {
+		return nil, false, err
+	}
+	hasMore := len(entries) > limit
+	if hasMore {
+		entries = entries[:limit]
+	}
+	return entries, hasMore, nil
+}
@@ -0,0 +1,227 @@
+package services
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DarthPestilane/easytcp"
+)
+
+// SlowConsumerPolicy decides what happens when a session's outbound queue is full.
+type SlowConsumerPolicy string
+
+const (
+	// PolicyDropOldest discards the oldest queued push to make room.
+	PolicyDropOldest SlowConsumerPolicy = "drop_oldest"
+	// PolicyCoalesce replaces a queued push with the same coalesce key (e.g. repeated
+	// typing/presence updates), falling back to dropping the oldest push.
+	PolicyCoalesce SlowConsumerPolicy = "coalesce"
+	// PolicyDisconnect closes the session.
+	PolicyDisconnect SlowConsumerPolicy = "disconnect"
+)
+
+// outFrame is a packed message waiting to be written.
+type outFrame struct {
+	data       []byte
+	key        string // coalesce key; "" never coalesces
+	response   bool   // replies to requests are evicted only when no push is left to drop
+	closeAfter bool   // close the session once this frame is written
+}
+
+// outbox is a session's bounded outbound queue drained by a single writer goroutine,
+// so responses and pushes never interleave on the connection.
+type outbox struct {
+	sess   easytcp.Session
+	mu     sync.Mutex
+	queue  []outFrame
+	notify chan struct{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+var (
+	outboxes   = make(map[interface{}]*outbox)
+	outboxesMu sync.RWMutex
+
+	outboxSize         int
+	outboxWriteTimeout time.Duration
+	slowConsumerPolicy SlowConsumerPolicy
+	outboxEnvOnce      sync.Once
+)
+
+// loadOutboxEnv reads OUTBOX_SIZE (default 256 frames), OUTBOX_WRITE_TIMEOUT
+// (default 10s) and SLOW_CONSUMER_POLICY (drop_oldest, coalesce or disconnect).
+func loadOutboxEnv() {
+	outboxEnvOnce.Do(func() {
+		outboxSize = envInt("OUTBOX_SIZE", 256)
+		if outboxSize <= 0 {
+			outboxSize = 256
+		}
+		outboxWriteTimeout = envDuration("OUTBOX_WRITE_TIMEOUT", 10*time.Second)
+		switch p := SlowConsumerPolicy(strings.ToLower(envString("SLOW_CONSUMER_POLICY", string(PolicyDropOldest)))); p {
+		case PolicyDropOldest, PolicyCoalesce, PolicyDisconnect:
+			slowConsumerPolicy = p
+		default:
+			log.Printf("unknown SLOW_CONSUMER_POLICY %q, using %s", p, PolicyDropOldest)
+			slowConsumerPolicy = PolicyDropOldest
+		}
+	})
+}
+
+// OpenOutbox creates the session's outbound queue and starts its writer.
+// Call from OnSessionCreate before anything is sent to the session.
+func OpenOutbox(sess easytcp.Session) {
+	loadOutboxEnv()
+	ob := &outbox{
+		sess:   sess,
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	outboxesMu.Lock()
+	outboxes[sess.ID()] = ob
+	outboxesMu.Unlock()
+	go ob.run()
+}
+
+// CloseOutbox stops the writer and discards anything still queued.
+func CloseOutbox(sess easytcp.Session) {
+	outboxesMu.Lock()
+	ob, ok := outboxes[sess.ID()]
+	delete(outboxes, sess.ID())
+	outboxesMu.Unlock()
+	if ok {
+		ob.stop()
+	}
+}
+
+func getOutbox(sess easytcp.Session) *outbox {
+	outboxesMu.RLock()
+	defer outboxesMu.RUnlock()
+	return outboxes[sess.ID()]
+}
+
+// EnqueueResponse queues the reply to a request.
+func EnqueueResponse(sess easytcp.Session, msg *easytcp.Message) {
+	enqueue(sess, msg, outFrame{response: true})
+}
+
+// SendToSession pushes a server-initiated message to a single session.
+func SendToSession(sess easytcp.Session, msg *easytcp.Message) {
+	enqueue(sess, msg, outFrame{})
+}
+
+// SendAndClose pushes a final message and closes the session once it is written.
+func SendAndClose(sess easytcp.Session, msg *easytcp.Message) {
+	if !enqueue(sess, msg, outFrame{response: true, closeAfter: true}) {
+		sess.Close()
+	}
+}
+
+func enqueue(sess easytcp.Session, msg *easytcp.Message, f outFrame) bool {
+	data, err := roomPacker.Pack(msg)
+	if err != nil {
+		log.Printf("pack outbound message %v for session %v failed: %v", msg.ID(), sess.ID(), err)
+		return false
+	}
+	f.data = data
+	return enqueueFrame(sess, f)
+}
+
+func enqueueFrame(sess easytcp.Session, f outFrame) bool {
+	ob := getOutbox(sess)
+	if ob == nil {
+		log.Printf("dropping outbound frame for session %v: no outbox", sess.ID())
+		return false
+	}
+	return ob.push(f)
+}
+
+// push appends f, applying the slow-consumer policy when the queue is full.
+func (ob *outbox) push(f outFrame) bool {
+	ob.mu.Lock()
+	if len(ob.queue) >= outboxSize {
+		switch slowConsumerPolicy {
+		case PolicyDisconnect:
+			ob.mu.Unlock()
+			log.Printf("session %v outbox full (%d frames), disconnecting slow consumer", ob.sess.ID(), len(ob.queue))
+			ob.sess.Close()
+			return false
+		case PolicyCoalesce:
+			if f.key != "" {
+				for i := range ob.queue {
+					if ob.queue[i].key == f.key {
+						ob.queue[i] = f
+						ob.mu.Unlock()
+						return true
+					}
+				}
+			}
+			ob.evictLocked()
+		default:
+			ob.evictLocked()
+		}
+	}
+	ob.queue = append(ob.queue, f)
+	ob.mu.Unlock()
+
+	select {
+	case ob.notify <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// evictLocked drops the oldest push, or the oldest frame if only responses are queued.
+func (ob *outbox) evictLocked() {
+	victim := 0
+	for i := range ob.queue {
+		if !ob.queue[i].response {
+			victim = i
+			break
+		}
+	}
+	log.Printf("session %v outbox full, dropping oldest frame", ob.sess.ID())
+	ob.queue = append(ob.queue[:victim], ob.queue[victim+1:]...)
+}
+
+func (ob *outbox) stop() {
+	ob.once.Do(func() { close(ob.done) })
+}
+
+// run is the session's only writer to the connection.
+func (ob *outbox) run() {
+	for {
+		select {
+		case <-ob.done:
+			return
+		case <-ob.notify:
+		}
+
+		for {
+			ob.mu.Lock()
+			if len(ob.queue) == 0 {
+				ob.mu.Unlock()
+				break
+			}
+			f := ob.queue[0]
+			ob.queue = ob.queue[1:]
+			ob.mu.Unlock()
+
+			conn := ob.sess.Conn()
+			if outboxWriteTimeout > 0 {
+				_ = conn.SetWriteDeadline(time.Now().Add(outboxWriteTimeout))
+			}
+			if _, err := conn.Write(f.data); err != nil {
+				log.Printf("write to session %v failed: %v", ob.sess.ID(), err)
+				ob.sess.Close()
+				return
+			}
+			if f.closeAfter {
+				ob.sess.Close()
+				return
+			}
+		}
+	}
+}
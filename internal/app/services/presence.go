@@ -0,0 +1,243 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"github.com/DarthPestilane/easytcp"
+)
+
+// PresenceRoute is the push route for a user's presence change in rooms they belong to.
+const PresenceRoute = 305
+
+// PresenceStatus is a user's aggregate status across all their connections.
+type PresenceStatus string
+
+const (
+	PresenceOnline  PresenceStatus = "online"
+	PresenceIdle    PresenceStatus = "idle"
+	PresenceOffline PresenceStatus = "offline"
+)
+
+// Presence is the data of a route 305 push and of each member in the member list.
+type Presence struct {
+	UserID     string         `json:"user_id"`
+	Status     PresenceStatus `json:"status"`
+	LastSeenAt string         `json:"last_seen_at,omitempty"`
+}
+
+// sessionPresence is one connection's contribution to its user's presence.
+type sessionPresence struct {
+	userID     string
+	lastActive time.Time
+	idle       bool // idle, either reported by the client or set by the idle sweeper
+	manualIdle bool // the client reported idle; activity alone does not clear it
+}
+
+var (
+	presenceMu       sync.Mutex
+	presenceSessions = make(map[interface{}]*sessionPresence)            // session ID -> state
+	presenceByUser   = make(map[string]map[interface{}]*sessionPresence) // user -> session ID -> state
+	presenceLastSeen = make(map[string]time.Time)                        // user -> when their last connection went away
+
+	presenceIdleAfter time.Duration
+	presenceOnce      sync.Once
+)
+
+// loadPresenceEnv reads PRESENCE_IDLE_AFTER (default 5m; 0 disables automatic idle)
+// and starts the idle sweeper.
+func loadPresenceEnv() {
+	presenceOnce.Do(func() {
+		presenceIdleAfter = envDuration("PRESENCE_IDLE_AFTER", 5*time.Minute)
+		if presenceIdleAfter > 0 {
+			go sweepIdle()
+		}
+	})
+}
+
+// PresenceConnect counts an authenticated connection toward the user's presence.
+// Calling it again for the same session (e.g. token refresh) just marks it active.
+func PresenceConnect(sess easytcp.Session, userID string) {
+	loadPresenceEnv()
+	presenceMu.Lock()
+	before := presenceStatusLocked(userID)
+	if sp, ok := presenceSessions[sess.ID()]; ok && sp.userID != userID {
+		removePresenceLocked(sess.ID())
+	}
+	sp, ok := presenceSessions[sess.ID()]
+	if !ok {
+		sp = &sessionPresence{userID: userID}
+		presenceSessions[sess.ID()] = sp
+		if presenceByUser[userID] == nil {
+			presenceByUser[userID] = make(map[interface{}]*sessionPresence)
+		}
+		presenceByUser[userID][sess.ID()] = sp
+	}
+	sp.lastActive = time.Now()
+	sp.idle = sp.manualIdle
+	after := presenceSnapshotLocked(userID)
+	sessions := presenceSessionIDsLocked(userID)
+	presenceMu.Unlock()
+
+	if after.Status != before {
+		announcePresence(after.UserID, sessions, nil)
+	}
+}
+
+// PresenceDisconnect removes a closed connection; the user goes offline with their last one.
+// Call it before RemoveSessionFromAllRooms so the rooms the connection was in still hear it.
+func PresenceDisconnect(sess easytcp.Session) {
+	presenceMu.Lock()
+	sp, ok := presenceSessions[sess.ID()]
+	if !ok {
+		presenceMu.Unlock()
+		return
+	}
+	before := presenceStatusLocked(sp.userID)
+	sessions := presenceSessionIDsLocked(sp.userID)
+	removePresenceLocked(sess.ID())
+	after := presenceSnapshotLocked(sp.userID)
+	presenceMu.Unlock()
+
+	if after.Status != before {
+		announcePresence(after.UserID, sessions, sess.ID())
+	}
+}
+
+// TouchPresence records activity on the connection, waking it from automatic idle.
+func TouchPresence(sess easytcp.Session) {
+	updateSessionPresence(sess, func(sp *sessionPresence) {
+		sp.lastActive = time.Now()
+		if !sp.manualIdle {
+			sp.idle = false
+		}
+	})
+}
+
+// SetSessionIdle records a client-reported idle/active state (e.g. app backgrounded).
+func SetSessionIdle(sess easytcp.Session, idle bool) {
+	updateSessionPresence(sess, func(sp *sessionPresence) {
+		sp.manualIdle = idle
+		sp.idle = idle
+		sp.lastActive = time.Now()
+	})
+}
+
+func updateSessionPresence(sess easytcp.Session, fn func(sp *sessionPresence)) {
+	presenceMu.Lock()
+	sp, ok := presenceSessions[sess.ID()]
+	if !ok {
+		presenceMu.Unlock()
+		return
+	}
+	before := presenceStatusLocked(sp.userID)
+	fn(sp)
+	after := presenceSnapshotLocked(sp.userID)
+	sessions := presenceSessionIDsLocked(sp.userID)
+	presenceMu.Unlock()
+
+	if after.Status != before {
+		announcePresence(after.UserID, sessions, nil)
+	}
+}
+
+// GetPresence returns the user's current aggregate presence.
+func GetPresence(userID string) Presence {
+	presenceMu.Lock()
+	defer presenceMu.Unlock()
+	return presenceSnapshotLocked(userID)
+}
+
+// removePresenceLocked drops a session's state. Caller must hold presenceMu.
+func removePresenceLocked(id interface{}) {
+	sp, ok := presenceSessions[id]
+	if !ok {
+		return
+	}
+	delete(presenceSessions, id)
+	delete(presenceByUser[sp.userID], id)
+	if len(presenceByUser[sp.userID]) == 0 {
+		delete(presenceByUser, sp.userID)
+		presenceLastSeen[sp.userID] = time.Now()
+	}
+}
+
+// presenceStatusLocked is online if any connection is active, idle if all are idle,
+// and offline without connections. Caller must hold presenceMu.
+func presenceStatusLocked(userID string) PresenceStatus {
+	conns := presenceByUser[userID]
+	if len(conns) == 0 {
+		return PresenceOffline
+	}
+	for _, sp := range conns {
+		if !sp.idle {
+			return PresenceOnline
+		}
+	}
+	return PresenceIdle
+}
+
+// presenceSessionIDsLocked returns the IDs of the user's connections. Caller must
+// hold presenceMu.
+func presenceSessionIDsLocked(userID string) []interface{} {
+	ids := make([]interface{}, 0, len(presenceByUser[userID]))
+	for id := range presenceByUser[userID] {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func presenceSnapshotLocked(userID string) Presence {
+	p := Presence{UserID: userID, Status: presenceStatusLocked(userID)}
+	if p.Status == PresenceOffline {
+		if t, ok := presenceLastSeen[userID]; ok {
+			p.LastSeenAt = t.UTC().Format(time.RFC3339)
+		}
+	}
+	return p
+}
+
+// sweepIdle marks connections idle once they have been quiet for presenceIdleAfter.
+func sweepIdle() {
+	interval := presenceIdleAfter / 4
+	if interval < time.Second {
+		interval = time.Second
+	}
+	type change struct {
+		userID   string
+		sessions []interface{}
+	}
+	for range time.Tick(interval) {
+		var changed []change
+		presenceMu.Lock()
+		cutoff := time.Now().Add(-presenceIdleAfter)
+		for userID, conns := range presenceByUser {
+			before := presenceStatusLocked(userID)
+			for _, sp := range conns {
+				if !sp.idle && sp.lastActive.Before(cutoff) {
+					sp.idle = true
+				}
+			}
+			if presenceStatusLocked(userID) != before {
+				changed = append(changed, change{userID, presenceSessionIDsLocked(userID)})
+			}
+		}
+		presenceMu.Unlock()
+
+		for _, c := range changed {
+			announcePresence(c.userID, c.sessions, nil)
+		}
+	}
+}
+
+// announcePresence pushes the user's presence to every room one of their sessions
+// is subscribed to, except to skipID. Rooms they subscribe to later get it then (see
+// AddSessionToRoom). Under the coalesce policy only the latest update per user stays
+// queued for slow sessions.
+func announcePresence(userID string, sessions []interface{}, skipID interface{}) {
+	// Announcements can race; send the state as of now so a stale one never lands last.
+	msg := NewEnvelopeMessage(PresenceRoute, Success(GetPresence(userID)))
+	for _, roomID := range roomsOfSessions(sessions) {
+		BroadcastToRoomCoalesced(roomID, "presence:"+userID, msg, skipID)
+	}
+}
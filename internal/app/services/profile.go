@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// profileEntry caches one user's profile; found is false for users with no profile.
+type profileEntry struct {
+	profile Profile
+	found   bool
+	expires time.Time
+}
+
+var (
+	profileCache   = make(map[string]profileEntry)
+	profileCacheMu sync.RWMutex
+
+	profileTTL     time.Duration
+	profileEnvOnce sync.Once
+)
+
+// loadProfileEnv reads PROFILE_CACHE_TTL (default 10m). Updates made through this
+// server invalidate entries immediately; the TTL bounds staleness for the rest.
+func loadProfileEnv() {
+	profileEnvOnce.Do(func() {
+		profileTTL = envDuration("PROFILE_CACHE_TTL", 10*time.Minute)
+	})
+}
+
+// GetProfiles returns the profiles of the given users keyed by user ID, serving
+// from the cache and fetching all misses from the store in one batch. Users
+// without a profile are left out, and that is cached for the TTL too.
+func GetProfiles(ctx context.Context, userIDs []string) (map[string]Profile, error) {
+	loadProfileEnv()
+	out := make(map[string]Profile, len(userIDs))
+	missing := make([]string, 0)
+	seen := make(map[string]bool, len(userIDs))
+
+	now := time.Now()
+	profileCacheMu.RLock()
+	for _, id := range userIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		e, ok := profileCache[id]
+		switch {
+		case !ok || !now.Before(e.expires):
+			missing = append(missing, id)
+		case e.found:
+			out[id] = e.profile
+		}
+	}
+	profileCacheMu.RUnlock()
+	if len(missing) == 0 {
+		return out, nil
+	}
+
+	fetched, err := currentStore().GetProfiles(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+
+	expires := time.Now().Add(profileTTL)
+	profileCacheMu.Lock()
+	defer profileCacheMu.Unlock()
+	for _, p := range fetched {
+		out[p.UserID] = p
+		profileCache[p.UserID] = profileEntry{profile: p, found: true, expires: expires}
+	}
+	for _, id := range missing {
+		if _, ok := out[id]; !ok {
+			profileCache[id] = profileEntry{expires: expires}
+		}
+	}
+	return out, nil
+}
+
+// GetProfile returns one user's profile, or ErrNotFound.
+func GetProfile(ctx context.Context, userID string) (*Profile, error) {
+	profiles, err := GetProfiles(ctx, []string{userID})
+	if err != nil {
+		return nil, err
+	}
+	p, ok := profiles[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &p, nil
+}
+
+// InvalidateProfile drops the user's cached profile after it changes.
+func InvalidateProfile(userID string) {
+	profileCacheMu.Lock()
+	defer profileCacheMu.Unlock()
+	delete(profileCache, userID)
+}
+
+// UserNames resolves display names for the given users; unknown users are left out.
+// Lookup failures are logged and yield an empty map so callers can still answer.
+func UserNames(ctx context.Context, userIDs []string) map[string]string {
+	names := make(map[string]string, len(userIDs))
+	profiles, err := GetProfiles(ctx, userIDs)
+	if err != nil {
+		Logf(ctx, "profile lookup failed for %d users: %v", len(userIDs), err)
+		return names
+	}
+	for id, p := range profiles {
+		names[id] = p.UserName
+	}
+	return names
+}
+
+// DisplayName is the user's profile name, or fallback (e.g. the login token's name)
+// when they have none.
+func DisplayName(ctx context.Context, userID, fallback string) string {
+	if p, err := GetProfile(ctx, userID); err == nil && p.UserName != "" {
+		return p.UserName
+	}
+	return fallback
+}
+
+// RememberProfile creates the user's profile from login data on first login and
+// returns the name the session should use: the profile's, once the user has one.
+// Existing profiles are not overwritten, so names set on route 502 survive logins.
+func RememberProfile(ctx context.Context, userID, userName string) (string, error) {
+	err := currentStore().EnsureProfile(ctx, &Profile{UserID: userID, UserName: userName})
+	InvalidateProfile(userID)
+	if err != nil {
+		return userName, err
+	}
+	return DisplayName(ctx, userID, userName), nil
+}
+
+// ProfileUpdate lists the profile fields to change; nil fields keep their value.
+type ProfileUpdate struct {
+	UserName  *string
+	AvatarURL *string
+	Bio       *string
+}
+
+// UpdateProfile applies upd to the user's profile (starting from fallbackName if
+// they have none yet). When something changed it refreshes the profile cache and
+// the name on the user's sessions, and pushes a profile_changed event to their rooms.
+func UpdateProfile(ctx context.Context, userID, fallbackName string, upd ProfileUpdate) (*Profile, error) {
+	st := currentStore()
+	// Read past the cache so concurrent edits from another server are not undone.
+	rows, err := st.GetProfiles(ctx, []string{userID})
+	if err != nil {
+		return nil, err
+	}
+	current := Profile{UserID: userID, UserName: fallbackName}
+	if len(rows) > 0 {
+		current = rows[0]
+	}
+
+	next := current
+	if upd.UserName != nil {
+		next.UserName = *upd.UserName
+	}
+	if upd.AvatarURL != nil {
+		next.AvatarURL = *upd.AvatarURL
+	}
+	if upd.Bio != nil {
+		next.Bio = *upd.Bio
+	}
+	if next == current && len(rows) > 0 {
+		return &next, nil
+	}
+
+	if err := st.UpdateProfile(ctx, &next); err != nil {
+		return nil, err
+	}
+	InvalidateProfile(userID)
+	if next.UserName != current.UserName {
+		SetUserName(userID, next.UserName)
+	}
+
+	rooms, err := st.ListRoomsByUser(ctx, userID)
+	if err != nil {
+		Logf(ctx, "profile_changed: list rooms for %s failed: %v", userID, err)
+		return &next, nil
+	}
+	for _, r := range rooms {
+		BroadcastRoomEvent(r.ID, EventProfileChanged, userID, next)
+	}
+	return &next, nil
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/DarthPestilane/easytcp"
+)
+
+// ProtocolVersion is bumped whenever a route's request or response shape changes incompatibly.
+const ProtocolVersion = 2
+
+// MaxPacketSize is the largest frame payload the server's packer accepts.
+const MaxPacketSize = 10 * 1024 * 1024
+
+// ServerFeatures are the optional capabilities this build supports; clients
+// should only use a feature that appears in the hello response.
+var ServerFeatures = []string{
+	"envelope",        // every response/push is a services.Envelope
+	"request_id",      // request_id is echoed back
+	"token_refresh",   // route 11 + auth-expired push on 12
+	"room_subscribe",  // explicit 220/221 subscriptions; 301/310 no longer subscribe
+	"presence",        // presence pushes on 305, member list on 230
+	"typing",          // typing route 320, pushes on 304
+	"reactions",       // routes 313/314, reaction events on 303, reactions in 310
+	"threads",         // reply_to_id / thread_root_id on 301, thread page 315
+	"idempotent_send", // client_msg_id on 301
+	"resume",          // seq on 302/303 pushes, resume on 330
+	"profiles",        // profile routes 501/502, profile_changed events
+	"roles",           // room roles and capabilities, promote/demote on 231/232
+	"moderation",      // kick/ban/mute on 233-237, moderation log on 238
+	"room_settings",   // room settings 204, delete 205, archived rooms read-only
+}
+
+// DeprecatedRoute describes a route clients should stop using.
+type DeprecatedRoute struct {
+	Route       int    `json:"route"`
+	Replacement int    `json:"replacement,omitempty"`
+	Note        string `json:"note,omitempty"`
+}
+
+// DeprecatedRoutes lists routes scheduled for removal.
+var DeprecatedRoutes = []DeprecatedRoute{}
+
+// Limits are the server-enforced size limits announced in the handshake.
+type Limits struct {
+	MaxPacketSize    int `json:"max_packet_size"`
+	MaxMessageLength int `json:"max_message_length"`
+}
+
+var (
+	maxMessageLength int
+	minClientVersion string
+	protocolEnvOnce  sync.Once
+)
+
+// loadProtocolEnv reads MAX_MESSAGE_LENGTH (default 4000 characters) and MIN_CLIENT_VERSION.
+func loadProtocolEnv() {
+	protocolEnvOnce.Do(func() {
+		maxMessageLength = envInt("MAX_MESSAGE_LENGTH", 4000)
+		minClientVersion = envString("MIN_CLIENT_VERSION", "")
+	})
+}
+
+// CurrentLimits returns the limits announced to clients.
+func CurrentLimits() Limits {
+	loadProtocolEnv()
+	return Limits{MaxPacketSize: MaxPacketSize, MaxMessageLength: maxMessageLength}
+}
+
+// MinClientVersion returns the configured minimum app version ("" means any).
+func MinClientVersion() string {
+	loadProtocolEnv()
+	return minClientVersion
+}
+
+// ClientInfo is what a connection declared in its hello.
+type ClientInfo struct {
+	AppVersion string
+	Features   []string // negotiated: requested by the client and supported by the server
+	Refused    bool     // app version below MinClientVersion
+}
+
+var (
+	clientInfos   = make(map[interface{}]*ClientInfo)
+	clientInfosMu sync.RWMutex
+)
+
+// StoreClientInfo records the handshake result for the connection.
+func StoreClientInfo(sess easytcp.Session, info *ClientInfo) {
+	clientInfosMu.Lock()
+	defer clientInfosMu.Unlock()
+	clientInfos[sess.ID()] = info
+}
+
+// GetClientInfo returns the connection's handshake result, or nil if it never said hello.
+func GetClientInfo(sess easytcp.Session) *ClientInfo {
+	clientInfosMu.RLock()
+	defer clientInfosMu.RUnlock()
+	return clientInfos[sess.ID()]
+}
+
+// RemoveClientInfo drops handshake data when the connection closes.
+func RemoveClientInfo(sess easytcp.Session) {
+	clientInfosMu.Lock()
+	defer clientInfosMu.Unlock()
+	delete(clientInfos, sess.ID())
+}
+
+// NegotiateFeatures returns the client's requested features that the server supports.
+func NegotiateFeatures(requested []string) []string {
+	supported := make(map[string]bool, len(ServerFeatures))
+	for _, f := range ServerFeatures {
+		supported[f] = true
+	}
+	out := make([]string, 0, len(requested))
+	for _, f := range requested {
+		if supported[f] {
+			out = append(out, f)
+			supported[f] = false // de-duplicate
+		}
+	}
+	return out
+}
+
+// CompareVersions compares dotted numeric versions ("1.4.2", "1.4.2+37", "v2.0-beta"),
+// returning -1, 0 or 1. Missing or non-numeric parts count as 0.
+func CompareVersions(a, b string) int {
+	pa, pb := versionParts(a), versionParts(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func versionParts(v string) []int {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(v, "-+ "); i >= 0 {
+		v = v[:i]
+	}
+	fields := strings.Split(v, ".")
+	parts := make([]int, len(fields))
+	for i, f := range fields {
+		parts[i], _ = strconv.Atoi(f)
+	}
+	return parts
+}
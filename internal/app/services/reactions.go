@@ -0,0 +1,78 @@
+package services
+
+import "context"
+
+// ReactionSummary aggregates one emoji on a message for a particular viewer.
+type ReactionSummary struct {
+	Emoji       string `json:"emoji"`
+	Count       int    `json:"count"`
+	ReactedByMe bool   `json:"reacted_by_me"`
+}
+
+// ReactionDelta is the data of a reaction_added / reaction_removed room event.
+type ReactionDelta struct {
+	MessageID int64  `json:"message_id"`
+	Emoji     string `json:"emoji"`
+	Count     int    `json:"count"` // count for this emoji after the change
+}
+
+// AddReaction records userID's emoji on the message. changed is false if it was already there.
+func AddReaction(ctx context.Context, messageID int64, userID, emoji string) (delta ReactionDelta, changed bool, err error) {
+	changed, err = currentStore().AddReaction(ctx, messageID, userID, emoji)
+	if err != nil {
+		return ReactionDelta{}, false, err
+	}
+	delta, err = reactionDelta(ctx, messageID, emoji)
+	return delta, changed, err
+}
+
+// RemoveReaction removes userID's emoji. changed is false if it was not there.
+func RemoveReaction(ctx context.Context, messageID int64, userID, emoji string) (delta ReactionDelta, changed bool, err error) {
+	changed, err = currentStore().RemoveReaction(ctx, messageID, userID, emoji)
+	if err != nil {
+		return ReactionDelta{}, false, err
+	}
+	delta, err = reactionDelta(ctx, messageID, emoji)
+	return delta, changed, err
+}
+
+func reactionDelta(ctx context.Context, messageID int64, emoji string) (ReactionDelta, error) {
+	reactions, err := currentStore().ListReactions(ctx, []int64{messageID})
+	if err != nil {
+		return ReactionDelta{}, err
+	}
+	d := ReactionDelta{MessageID: messageID, Emoji: emoji}
+	for _, r := range reactions {
+		if r.Emoji == emoji {
+			d.Count++
+		}
+	}
+	return d, nil
+}
+
+// SummarizeReactions returns per-message reaction summaries as seen by viewerID,
+// emojis in the order they were first used on each message.
+func SummarizeReactions(ctx context.Context, messageIDs []int64, viewerID string) (map[int64][]ReactionSummary, error) {
+	reactions, err := currentStore().ListReactions(ctx, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[int64][]ReactionSummary)
+	for _, r := range reactions {
+		summaries := out[r.MessageID]
+		i := 0
+		for i < len(summaries) && summaries[i].Emoji != r.Emoji {
+			i++
+		}
+		if i == len(summaries) {
+			summaries = append(summaries, ReactionSummary{Emoji: r.Emoji})
+		}
+		summaries[i].Count++
+		if r.UserID == viewerID {
+			summaries[i].ReactedByMe = true
+		}
+		out[r.MessageID] = summaries
+	}
+	return out, nil
+}
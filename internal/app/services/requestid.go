@@ -0,0 +1,42 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+)
+
+// RequestIDKey is the context key holding the current request's correlation ID.
+// It is a plain string because easytcp.Context.Value only resolves string keys
+// stored with Set.
+const RequestIDKey = "request_id"
+
+// RequestIDHeader carries the correlation ID on outbound Supabase calls.
+const RequestIDHeader = "X-Request-Id"
+
+// NewRequestID returns a random ID for requests that did not supply one.
+func NewRequestID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(buf)
+}
+
+// RequestID returns the correlation ID stored on ctx, or "".
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(RequestIDKey).(string)
+	return id
+}
+
+// Logf logs like log.Printf, prefixed with the request's correlation ID when present.
+func Logf(ctx context.Context, format string, args ...interface{}) {
+	if id := RequestID(ctx); id != "" {
+		format = "[req=" + id + "] " + format
+	}
+	log.Printf(format, args...)
+}
@@ -0,0 +1,121 @@
+package services
+
+import "context"
+
+// Room member roles stored in room_members.role, most privileged first.
+const (
+	RoleOwner    = "owner"
+	RoleAdmin    = "admin"
+	RoleMember   = "member"
+	RoleReadOnly = "read_only"
+)
+
+// Capability is something a room role may be allowed to do.
+type Capability string
+
+const (
+	CapSend         Capability = "send"          // post, edit own messages, react, typing
+	CapDeleteOthers Capability = "delete_others" // delete other members' messages
+	CapKick         Capability = "kick"          // remove members from the room
+	CapInvite       Capability = "invite"        // see and share the room's join code
+	CapEditSettings Capability = "edit_settings" // change room settings
+	CapManageRoles  Capability = "manage_roles"  // promote and demote members
+)
+
+// roleCapabilities is the capability matrix. Every room route checks it through
+// Can before acting; a role missing from the map can do nothing beyond reading.
+var roleCapabilities = map[string][]Capability{
+	RoleOwner:    {CapSend, CapDeleteOthers, CapKick, CapInvite, CapEditSettings, CapManageRoles},
+	RoleAdmin:    {CapSend, CapDeleteOthers, CapKick, CapInvite, CapEditSettings, CapManageRoles},
+	RoleMember:   {CapSend, CapInvite},
+	RoleReadOnly: {},
+}
+
+// archivedCapabilities are the only capabilities left in an archived room: it stays
+// readable and manageable, but nothing new is posted, deleted or shared.
+var archivedCapabilities = map[Capability]bool{
+	CapKick:         true,
+	CapEditSettings: true,
+	CapManageRoles:  true,
+}
+
+// roleRanks orders roles for promotion rules: a member may only manage roles ranked
+// below their own.
+var roleRanks = map[string]int{
+	RoleOwner:    3,
+	RoleAdmin:    2,
+	RoleMember:   1,
+	RoleReadOnly: 0,
+}
+
+// Can reports whether the role grants the capability.
+func Can(role string, c Capability) bool {
+	for _, have := range roleCapabilities[role] {
+		if have == c {
+			return true
+		}
+	}
+	return false
+}
+
+// Capabilities lists what the role may do, for clients to adapt their UI.
+func Capabilities(role string) []Capability {
+	caps := roleCapabilities[role]
+	out := make([]Capability, len(caps))
+	copy(out, caps)
+	return out
+}
+
+// AllowedWhenArchived reports whether the capability still applies in an archived room.
+func AllowedWhenArchived(c Capability) bool {
+	return archivedCapabilities[c]
+}
+
+// RoomCapabilities is Capabilities narrowed to what an archived room still allows.
+func RoomCapabilities(role string, archived bool) []Capability {
+	caps := Capabilities(role)
+	if !archived {
+		return caps
+	}
+	out := caps[:0]
+	for _, c := range caps {
+		if archivedCapabilities[c] {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// ValidRole reports whether role is a known room role.
+func ValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// RoleRank returns the role's position in the hierarchy; unknown roles rank lowest.
+func RoleRank(role string) int {
+	if r, ok := roleRanks[role]; ok {
+		return r
+	}
+	return -1
+}
+
+// CanManageRole reports whether actorRole may move a member from currentRole to
+// newRole: it needs CapManageRoles and must outrank both roles.
+func CanManageRole(actorRole, currentRole, newRole string) bool {
+	if !Can(actorRole, CapManageRoles) {
+		return false
+	}
+	rank := RoleRank(actorRole)
+	return rank > RoleRank(currentRole) && rank > RoleRank(newRole)
+}
+
+// SetMemberRole changes a member's role; ErrNotFound if they are not a member.
+// Ownership moves through TransferOwnership instead.
+func SetMemberRole(ctx context.Context, roomID, userID, role string) error {
+	if err := currentStore().SetMemberRole(ctx, roomID, userID, role); err != nil {
+		return err
+	}
+	InvalidateMembership(roomID, userID)
+	return nil
+}
@@ -1,120 +1,158 @@
 package services
 
 import (
-	"bytes"
-	"encoding/json"
-	"fmt"
-	"io"
-	"net/http"
-	"net/url"
+	"context"
+	"sync"
 	"time"
 )
 
 type Room struct {
-	ID        string    `json:"id,omitempty"`
-	Code      string    `json:"code"`
-	OwnerID   string    `json:"owner_id"`
-	Title     string    `json:"title"`
-	IsPrivate bool      `json:"is_private"`
-	CreatedAt time.Time `json:"created_at,omitempty"`
+	ID        string `json:"id,omitempty"`
+	Code      string `json:"code"`
+	OwnerID   string `json:"owner_id"`
+	Title     string `json:"title"`
+	IsPrivate bool   `json:"is_private"`
+	// Description and Topic are free text set through the room settings route.
+	Description string    `json:"description,omitempty"`
+	Topic       string    `json:"topic,omitempty"`
+	CreatedAt   time.Time `json:"created_at,omitempty"`
+	// ArchivedAt is set once the room is archived (e.g. its last member left).
+	ArchivedAt *time.Time `json:"archived_at,omitempty"`
 }
 
-// CreateRoom inserts a new room into Supabase database using the create_room_with_owner function.
-func CreateRoom(ownerID, title string, isPrivate bool) (*Room, error) {
-	loadEnv()
-
-	// Call the PostgreSQL function with owner_id parameter
-	payload := map[string]interface{}{
-		"_owner_id":   ownerID,
-		"_title":      title,
-		"_is_private": isPrivate,
-	}
+// JoinedRoom is a room listed for one of its members, with that member's role.
+type JoinedRoom struct {
+	Room
+	Role string `json:"role"`
+}
 
-	payloadBytes, err := json.Marshal(payload)
+// CreateRoom creates a room owned by ownerID; the store generates the join code.
+func CreateRoom(ctx context.Context, ownerID, title string, isPrivate bool) (*Room, error) {
+	room, err := currentStore().CreateRoom(ctx, ownerID, title, isPrivate)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+		return nil, err
 	}
+	InvalidateMembership(room.ID, ownerID)
+	return room, nil
+}
 
-	req, _ := http.NewRequest("POST", supabaseURL+"/rest/v1/rpc/create_room_with_owner", bytes.NewReader(payloadBytes))
-	req.Header.Set("Authorization", "Bearer "+supabaseAPIKey)
-	req.Header.Set("apikey", supabaseAPIKey)
-	req.Header.Set("Content-Type", "application/json")
+// ListRoomsByUser returns rooms the user has joined (via room_members) with their role
+// in each.
+func ListRoomsByUser(ctx context.Context, userID string) ([]JoinedRoom, error) {
+	return currentStore().ListRoomsByUser(ctx, userID)
+}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create room: %w", err)
-	}
-	defer resp.Body.Close()
+// roomEntry caches one room lookup for the archived check on every room write.
+type roomEntry struct {
+	room    *Room
+	expires time.Time
+}
 
-	if resp.StatusCode != 200 {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("supabase create room failed (status %d): %s", resp.StatusCode, body)
-	}
+var (
+	roomCache   = make(map[string]roomEntry)
+	roomCacheMu sync.RWMutex
+)
 
-	// The function returns {"room_id": "...", "code": "..."}
-	var result map[string]string
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("failed to decode room response: %w", err)
+// GetRoom returns the room, cached like memberships (MEMBERSHIP_CACHE_TTL) and
+// dropped when its settings change here. ErrNotFound if it does not exist.
+func GetRoom(ctx context.Context, roomID string) (*Room, error) {
+	loadMembershipEnv()
+	roomCacheMu.RLock()
+	e, ok := roomCache[roomID]
+	roomCacheMu.RUnlock()
+	if ok && time.Now().Before(e.expires) {
+		r := *e.room
+		return &r, nil
 	}
 
-	return &Room{
-		ID:        result["room_id"],
-		Code:      result["code"],
-		OwnerID:   ownerID,
-		Title:     title,
-		IsPrivate: isPrivate,
-	}, nil
+	room, err := currentStore().GetRoom(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	roomCacheMu.Lock()
+	roomCache[roomID] = roomEntry{room: room, expires: time.Now().Add(membershipTTL)}
+	roomCacheMu.Unlock()
+	r := *room
+	return &r, nil
 }
 
-// ListRoomsByUser returns rooms the user has joined (via room_members).
-func ListRoomsByUser(userID string) ([]Room, error) {
-	loadEnv()
+// IsRoomArchived reports whether the room is archived (read-only).
+func IsRoomArchived(ctx context.Context, roomID string) (bool, error) {
+	room, err := GetRoom(ctx, roomID)
+	if err != nil {
+		return false, err
+	}
+	return room.ArchivedAt != nil, nil
+}
 
-	// Query rooms with an inner join on room_members to ensure the user is a member.
-	q := url.Values{}
-	q.Set("select", "id,code,owner_id,title,is_private,created_at,room_members!inner(role,account_id)")
-	q.Set("room_members.account_id", "eq."+userID)
+func invalidateRoom(roomID string) {
+	roomCacheMu.Lock()
+	defer roomCacheMu.Unlock()
+	delete(roomCache, roomID)
+}
 
-	endpoint := fmt.Sprintf("%s/rest/v1/rooms?%s", supabaseURL, q.Encode())
-	req, _ := http.NewRequest("GET", endpoint, nil)
-	req.Header.Set("Authorization", "Bearer "+supabaseAPIKey)
-	req.Header.Set("apikey", supabaseAPIKey)
+// RoomSettings is a partial room settings update; nil fields are left unchanged.
+type RoomSettings struct {
+	Title       *string
+	IsPrivate   *bool
+	Description *string
+	Topic       *string
+	Archived    *bool
+}
 
-	resp, err := http.DefaultClient.Do(req)
+// UpdateRoomSettings applies the update and returns the room plus the names of the
+// settings that actually changed (empty when the update was a no-op).
+func UpdateRoomSettings(ctx context.Context, roomID string, upd RoomSettings) (*Room, []string, error) {
+	st := currentStore()
+	room, err := st.GetRoom(ctx, roomID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch rooms: %w", err)
+		return nil, nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("fetch rooms failed (status %d): %s", resp.StatusCode, body)
+	changed := make([]string, 0, 5)
+	if upd.Title != nil && *upd.Title != room.Title {
+		room.Title = *upd.Title
+		changed = append(changed, "title")
 	}
-
-	// Response is rows from rooms table; we only need the room fields.
-	var rows []struct {
-		ID        string    `json:"id"`
-		Code      string    `json:"code"`
-		OwnerID   string    `json:"owner_id"`
-		Title     string    `json:"title"`
-		IsPrivate bool      `json:"is_private"`
-		CreatedAt time.Time `json:"created_at"`
+	if upd.IsPrivate != nil && *upd.IsPrivate != room.IsPrivate {
+		room.IsPrivate = *upd.IsPrivate
+		changed = append(changed, "is_private")
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&rows); err != nil {
-		return nil, fmt.Errorf("failed to decode rooms: %w", err)
+	if upd.Description != nil && *upd.Description != room.Description {
+		room.Description = *upd.Description
+		changed = append(changed, "description")
+	}
+	if upd.Topic != nil && *upd.Topic != room.Topic {
+		room.Topic = *upd.Topic
+		changed = append(changed, "topic")
+	}
+	if upd.Archived != nil && *upd.Archived != (room.ArchivedAt != nil) {
+		room.ArchivedAt = nil
+		if *upd.Archived {
+			now := time.Now().UTC()
+			room.ArchivedAt = &now
+		}
+		changed = append(changed, "archived")
+	}
+	if len(changed) == 0 {
+		return room, changed, nil
 	}
 
-	rooms := make([]Room, 0, len(rows))
-	for _, r := range rows {
-		rooms = append(rooms, Room{
-			ID:        r.ID,
-			Code:      r.Code,
-			OwnerID:   r.OwnerID,
-			Title:     r.Title,
-			IsPrivate: r.IsPrivate,
-			CreatedAt: r.CreatedAt,
-		})
+	if err := st.UpdateRoom(ctx, room); err != nil {
+		return nil, nil, err
 	}
+	invalidateRoom(roomID)
+	return room, changed, nil
+}
 
-	return rooms, nil
+// DeleteRoom deletes the room and everything in it, and forgets its cached room,
+// membership and mute lookups. The caller closes the room's sessions (CloseDeletedRoom).
+func DeleteRoom(ctx context.Context, roomID string) error {
+	if err := currentStore().DeleteRoom(ctx, roomID); err != nil {
+		return err
+	}
+	invalidateRoomMemberships(roomID)
+	invalidateRoomMutes(roomID)
+	invalidateRoom(roomID)
+	return nil
 }
@@ -0,0 +1,67 @@
+package services
+
+import "time"
+
+// RoomEventRoute is the push route for room system events (members leaving,
+// ownership changes, message edits and deletes, reactions, ...). Chat messages keep their own route 302.
+const RoomEventRoute = 303
+
+// Room event types carried in RoomEvent.Type.
+const (
+	// EventMemberJoined carries {user_name} when a new member joins with the room code.
+	EventMemberJoined = "member_joined"
+	EventMemberLeft   = "member_left"
+	EventOwnerChanged = "owner_changed"
+	// EventMessageEdited and EventMessageDeleted carry the updated message as data.
+	EventMessageEdited  = "message_edited"
+	EventMessageDeleted = "message_deleted"
+	// EventReactionAdded and EventReactionRemoved carry a ReactionDelta as data.
+	EventReactionAdded   = "reaction_added"
+	EventReactionRemoved = "reaction_removed"
+	// EventRoleChanged carries {role, previous_role, changed_by} for the member in UserID.
+	EventRoleChanged = "role_changed"
+	// Moderation events carry the moderation log entry for the member in UserID.
+	// Kicked and banned members receive the event before they are unsubscribed.
+	EventMemberKicked   = "member_kicked"
+	EventMemberBanned   = "member_banned"
+	EventMemberUnbanned = "member_unbanned"
+	EventMemberMuted    = "member_muted"
+	EventMemberUnmuted  = "member_unmuted"
+	// EventRoomUpdated carries {room, changed} after a settings change; room.code is blank.
+	EventRoomUpdated = "room_updated"
+	// EventRoomDeleted is sent just before the room's subscribers are dropped.
+	EventRoomDeleted = "room_deleted"
+	// EventProfileChanged carries the user's updated Profile.
+	EventProfileChanged = "profile_changed"
+)
+
+// RoomEvent is the data of a route 303 push.
+type RoomEvent struct {
+	Type   string `json:"type"`
+	RoomID string `json:"room_id"`
+	// UserID is the member the event is about (or who caused it), if any.
+	UserID string      `json:"user_id,omitempty"`
+	Data   interface{} `json:"data,omitempty"`
+	At     string      `json:"at"`
+}
+
+// BroadcastRoomEvent pushes a sequenced system event to every session subscribed to the room.
+func BroadcastRoomEvent(roomID, eventType, userID string, data interface{}) {
+	BroadcastSequenced(roomID, RoomEventRoute, Success(newRoomEvent(roomID, eventType, userID, data)))
+}
+
+// CloseDeletedRoom pushes EventRoomDeleted as the room's last event, unsubscribes its
+// sessions and drops its sequence log. Returns how many sessions were unsubscribed.
+func CloseDeletedRoom(roomID, userID string) int {
+	return CloseRoomLog(roomID, RoomEventRoute, Success(newRoomEvent(roomID, EventRoomDeleted, userID, nil)))
+}
+
+func newRoomEvent(roomID, eventType, userID string, data interface{}) RoomEvent {
+	return RoomEvent{
+		Type:   eventType,
+		RoomID: roomID,
+		UserID: userID,
+		Data:   data,
+		At:     time.Now().UTC().Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,242 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/DarthPestilane/easytcp"
+)
+
+// Room pushes that change room state (302 messages and 303 room events) carry a
+// per-room sequence number in Envelope.Seq. Each room keeps its latest sequenced
+// frames in a ring so a reconnecting client can replay what it missed (route 330).
+// Sequence numbers live in memory: they restart with the process, which clients
+// detect through ServerEpoch and answer with a full refetch. Logs of idle rooms are
+// dropped; a recreated log continues from seqFloor, above every seq a dropped log
+// handed out, so a seq is never reused within an epoch.
+
+// roomLog is one room's sequence counter and its most recent sequenced frames.
+type roomLog struct {
+	mu     sync.Mutex
+	seq    int64
+	frames []seqFrame // oldest first, at most roomEventBuffer entries
+	used   time.Time  // last broadcast, subscribe or resume
+	// dropped is set once the log is removed from roomLogs; holders of a stale
+	// pointer must look the room up again.
+	dropped bool
+}
+
+type seqFrame struct {
+	seq  int64
+	data []byte
+}
+
+// ResumeResult reports how a room was resumed.
+type ResumeResult struct {
+	// Seq is the room's latest sequence number; later pushes continue from it.
+	Seq int64
+	// Replayed is how many missed pushes were queued to the session.
+	Replayed int
+	// Refetch means the gap could not be replayed and the client must reload the
+	// room (history on 310, members on 230) and continue from Seq.
+	Refetch bool
+}
+
+var (
+	roomLogs   = make(map[string]*roomLog)
+	roomLogsMu sync.Mutex
+	// seqFloor is the highest seq of any dropped log; new logs start from it.
+	seqFloor int64
+
+	// serverEpoch identifies this process's sequence numbers.
+	serverEpoch = NewRequestID()
+
+	roomEventBuffer int
+	roomLogIdleTTL  time.Duration
+	roomSeqEnvOnce  sync.Once
+)
+
+// loadRoomSeqEnv reads ROOM_EVENT_BUFFER (default 256): how many recent pushes per
+// room are kept for replay, and ROOM_LOG_IDLE_TTL (default 30m, 0 disables): how
+// long a room without subscribers keeps its log. It starts the idle sweeper.
+func loadRoomSeqEnv() {
+	roomSeqEnvOnce.Do(func() {
+		roomEventBuffer = envInt("ROOM_EVENT_BUFFER", 256)
+		if roomEventBuffer < 0 {
+			roomEventBuffer = 0
+		}
+		roomLogIdleTTL = envDuration("ROOM_LOG_IDLE_TTL", 30*time.Minute)
+		if roomLogIdleTTL > 0 {
+			go sweepRoomLogs()
+		}
+	})
+}
+
+// ServerEpoch returns the ID clients must send back on resume; it changes on restart.
+func ServerEpoch() string {
+	return serverEpoch
+}
+
+func getRoomLog(roomID string) *roomLog {
+	loadRoomSeqEnv()
+	roomLogsMu.Lock()
+	defer roomLogsMu.Unlock()
+	l := roomLogs[roomID]
+	if l == nil {
+		l = &roomLog{seq: seqFloor}
+		roomLogs[roomID] = l
+	}
+	return l
+}
+
+// dropRoomLogLocked removes the log and raises seqFloor past its seq. Caller must
+// hold roomLogsMu and l.mu.
+func dropRoomLogLocked(roomID string, l *roomLog) {
+	if l.seq > seqFloor {
+		seqFloor = l.seq
+	}
+	l.dropped = true
+	delete(roomLogs, roomID)
+}
+
+// lockRoomLog returns the room's current log with its mutex held.
+func lockRoomLog(roomID string) *roomLog {
+	for {
+		l := getRoomLog(roomID)
+		l.mu.Lock()
+		if !l.dropped {
+			return l
+		}
+		l.mu.Unlock()
+	}
+}
+
+// appendLocked stamps env with the next seq, packs it and keeps it for replay.
+// Caller must hold l.mu.
+func (l *roomLog) appendLocked(roomID string, route int, env Envelope) ([]byte, error) {
+	l.used = time.Now()
+	l.seq++
+	env.Seq = l.seq
+	data, err := roomPacker.Pack(NewEnvelopeMessage(route, env))
+	if err != nil {
+		return nil, fmt.Errorf("sequenced broadcast pack failed for room %s: %w", roomID, err)
+	}
+	if roomEventBuffer > 0 {
+		if len(l.frames) >= roomEventBuffer {
+			l.frames = l.frames[len(l.frames)-roomEventBuffer+1:]
+		}
+		l.frames = append(l.frames, seqFrame{seq: l.seq, data: data})
+	}
+	return data, nil
+}
+
+// CloseRoomLog sends env as the room's last sequenced push, then unsubscribes every
+// session and drops the room's log (after the room is deleted). It all happens under
+// the log lock, so no other push reaches the room's sessions afterwards. Returns how
+// many sessions were unsubscribed.
+func CloseRoomLog(roomID string, route int, env Envelope) int {
+	loadRoomSeqEnv()
+	roomLogsMu.Lock()
+	defer roomLogsMu.Unlock()
+	l := roomLogs[roomID]
+	if l == nil {
+		l = &roomLog{seq: seqFloor}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if data, err := l.appendLocked(roomID, route, env); err != nil {
+		log.Print(err)
+	} else {
+		broadcastFrame(roomID, outFrame{data: data}, nil)
+	}
+	n := removeRoomSubscriptions(roomID)
+	dropRoomLogLocked(roomID, l)
+	return n
+}
+
+// sweepRoomLogs drops the logs of rooms that have had no subscribers for
+// roomLogIdleTTL. A late resume of such a room gets a refetch, since its last_seq
+// is below the recreated log's replay buffer.
+func sweepRoomLogs() {
+	interval := roomLogIdleTTL / 4
+	if interval < time.Second {
+		interval = time.Second
+	}
+	for range time.Tick(interval) {
+		cutoff := time.Now().Add(-roomLogIdleTTL)
+		roomLogsMu.Lock()
+		for roomID, l := range roomLogs {
+			l.mu.Lock()
+			if l.used.Before(cutoff) && !hasRoomSubscribers(roomID) {
+				dropRoomLogLocked(roomID, l)
+			}
+			l.mu.Unlock()
+		}
+		roomLogsMu.Unlock()
+	}
+}
+
+// BroadcastSequenced stamps env with the room's next sequence number, records it for
+// replay and queues it for every session subscribed to the room. Returns the seq.
+func BroadcastSequenced(roomID string, route int, env Envelope) int64 {
+	l := lockRoomLog(roomID)
+	defer l.mu.Unlock()
+
+	data, err := l.appendLocked(roomID, route, env)
+	if err != nil {
+		log.Print(err)
+		return l.seq
+	}
+	// Queued under l.mu so every subscriber sees the room's pushes in seq order.
+	broadcastFrame(roomID, outFrame{data: data}, nil)
+	return l.seq
+}
+
+// SubscribeRoom tracks the session in the room and returns the seq that live pushes
+// will continue from.
+func SubscribeRoom(roomID string, sess easytcp.Session) int64 {
+	l := lockRoomLog(roomID)
+	defer l.mu.Unlock()
+	l.used = time.Now()
+	AddSessionToRoom(roomID, sess)
+	return l.seq
+}
+
+// ResumeRoom subscribes the session to the room and queues the sequenced pushes it
+// missed after lastSeq, ahead of any new ones. At most limit pushes are replayed;
+// a larger gap, an unknown epoch or a seq from the future asks for a refetch.
+func ResumeRoom(roomID string, sess easytcp.Session, epoch string, lastSeq int64, limit int) ResumeResult {
+	l := lockRoomLog(roomID)
+	defer l.mu.Unlock()
+	l.used = time.Now()
+	AddSessionToRoom(roomID, sess)
+
+	res := ResumeResult{Seq: l.seq}
+	if epoch != serverEpoch || lastSeq > l.seq {
+		res.Refetch = true
+		return res
+	}
+	missed := l.seq - lastSeq
+	if missed == 0 {
+		return res
+	}
+	if missed > int64(len(l.frames)) || missed > int64(limit) {
+		res.Refetch = true
+		return res
+	}
+	for _, f := range l.frames[int64(len(l.frames))-missed:] {
+		enqueueFrame(sess, outFrame{data: f.data})
+		res.Replayed++
+	}
+	return res
+}
+
+// ReplayBudget is how many pushes one resume request may replay to a session,
+// half its outbox so the replay cannot crowd out live traffic.
+func ReplayBudget() int {
+	loadOutboxEnv()
+	return outboxSize / 2
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"log"
 	"sync"
+	"time"
 
 	"github.com/DarthPestilane/easytcp"
 )
@@ -14,14 +15,49 @@ var (
 	roomPacker = easytcp.NewDefaultPacker()
 )
 
-// AddSessionToRoom tracks a session as present in a room.
+// AddSessionToRoom tracks a session as present in a room. When it is the user's
+// first session there, the room's other subscribers get the user's presence.
 func AddSessionToRoom(roomID string, sess easytcp.Session) {
+	us := GetSession(sess)
 	roomSubsMu.Lock()
-	defer roomSubsMu.Unlock()
 	if roomSubs[roomID] == nil {
 		roomSubs[roomID] = make(map[interface{}]easytcp.Session)
 	}
+	first := us != nil && !userSubscribedLocked(roomID, us.UserID)
 	roomSubs[roomID][sess.ID()] = sess
+	roomSubsMu.Unlock()
+
+	if first {
+		msg := NewEnvelopeMessage(PresenceRoute, Success(GetPresence(us.UserID)))
+		BroadcastToRoomCoalesced(roomID, "presence:"+us.UserID, msg, sess.ID())
+	}
+}
+
+// userSubscribedLocked reports whether any of the user's sessions is subscribed to
+// the room. Caller must hold roomSubsMu.
+func userSubscribedLocked(roomID, userID string) bool {
+	for _, sess := range roomSubs[roomID] {
+		if us := GetSession(sess); us != nil && us.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// roomsOfSessions returns the rooms any of the given sessions is subscribed to.
+func roomsOfSessions(ids []interface{}) []string {
+	roomSubsMu.RLock()
+	defer roomSubsMu.RUnlock()
+	rooms := make([]string, 0)
+	for roomID, subs := range roomSubs {
+		for _, id := range ids {
+			if _, ok := subs[id]; ok {
+				rooms = append(rooms, roomID)
+				break
+			}
+		}
+	}
+	return rooms
 }
 
 // RemoveSessionFromRoom removes a session from a specific room.
@@ -48,28 +84,88 @@ func RemoveSessionFromAllRooms(sess easytcp.Session) {
 	}
 }
 
-// BroadcastToRoom sends a message to all sessions tracked in the room.
+// RemoveUserFromRoom unsubscribes every session the user has open from the room
+// (after they leave or are removed) and returns how many were dropped.
+func RemoveUserFromRoom(roomID, userID string) int {
+	roomSubsMu.Lock()
+	defer roomSubsMu.Unlock()
+	n := 0
+	for id, sess := range roomSubs[roomID] {
+		if us := GetSession(sess); us != nil && us.UserID == userID {
+			delete(roomSubs[roomID], id)
+			n++
+		}
+	}
+	if len(roomSubs[roomID]) == 0 {
+		delete(roomSubs, roomID)
+	}
+	return n
+}
+
+// removeRoomSubscriptions unsubscribes every session from the room (after it is
+// deleted) and returns how many were dropped.
+func removeRoomSubscriptions(roomID string) int {
+	roomSubsMu.Lock()
+	defer roomSubsMu.Unlock()
+	n := len(roomSubs[roomID])
+	delete(roomSubs, roomID)
+	return n
+}
+
+// hasRoomSubscribers reports whether any session is subscribed to the room.
+func hasRoomSubscribers(roomID string) bool {
+	roomSubsMu.RLock()
+	defer roomSubsMu.RUnlock()
+	return len(roomSubs[roomID]) > 0
+}
+
+// BroadcastToRoom queues a message for all sessions tracked in the room.
 // If skipID is non-nil, that session ID will not receive the broadcast.
 func BroadcastToRoom(roomID string, msg *easytcp.Message, skipID interface{}) {
-	roomSubsMu.RLock()
-	subs := roomSubs[roomID]
-	roomSubsMu.RUnlock()
-	if len(subs) == 0 {
-		return
-	}
+	broadcast(roomID, msg, skipID, "")
+}
+
+// BroadcastToRoomCoalesced is BroadcastToRoom for state updates where only the
+// latest value matters: under the coalesce policy a slow session's queued frame
+// with the same key is replaced instead of piling up.
+func BroadcastToRoomCoalesced(roomID, key string, msg *easytcp.Message, skipID interface{}) {
+	broadcast(roomID, msg, skipID, key)
+}
 
+func broadcast(roomID string, msg *easytcp.Message, skipID interface{}, key string) {
+	// Pack once; each session's writer goroutine delivers it in order with its other traffic.
 	data, err := roomPacker.Pack(msg)
 	if err != nil {
 		log.Printf("broadcast pack failed for room %s: %v", roomID, err)
 		return
 	}
+	broadcastFrame(roomID, outFrame{data: data, key: key}, skipID)
+}
 
-	for id, sess := range subs {
+// broadcastFrame queues an already packed frame for the room's sessions.
+func broadcastFrame(roomID string, f outFrame, skipID interface{}) {
+	roomSubsMu.RLock()
+	targets := make([]easytcp.Session, 0, len(roomSubs[roomID]))
+	for id, sess := range roomSubs[roomID] {
 		if skipID != nil && id == skipID {
 			continue
 		}
-		if _, err := sess.Conn().Write(data); err != nil {
-			log.Printf("broadcast to room %s failed for session %v: %v", roomID, id, err)
+		targets = append(targets, sess)
+	}
+	roomSubsMu.RUnlock()
+
+	// Sessions whose token expired stay subscribed for route 11 but get nothing until then.
+	now := time.Now()
+	sessionsMu.RLock()
+	live := targets[:0]
+	for _, sess := range targets {
+		if authenticatedLocked(sess.ID(), now) {
+			live = append(live, sess)
 		}
 	}
+	sessionsMu.RUnlock()
+
+	for _, sess := range live {
+		enqueueFrame(sess, f)
+	}
 }
@@ -1,34 +1,142 @@
 package services
 
 import (
+	"log"
 	"sync"
+	"time"
 
 	"github.com/DarthPestilane/easytcp"
 )
 
+// AuthExpiredRoute is the push route used to tell a client its token expired.
+// The connection stays open; the client re-authenticates on the refresh route.
+const AuthExpiredRoute = 12
+
 // UserSession holds authenticated user data for a connection.
 type UserSession struct {
 	UserID        string
 	Email         string
 	UserName      string
 	Authenticated bool
+	ExpiresAt     time.Time // token expiry; zero means the token carried no exp
+
+	expiryTimer *time.Timer
 }
 
 var (
 	sessions   = make(map[interface{}]*UserSession)
 	sessionsMu sync.RWMutex
+
+	authRefreshGrace time.Duration
+	sessionEnvOnce   sync.Once
 )
 
-// StoreSession saves user info for the connection's lifetime.
-func StoreSession(sess easytcp.Session, userID, email, userName string) {
+// loadSessionEnv reads AUTH_REFRESH_GRACE (default 2m, 0 disables): how long an
+// expired session may wait for route 11 before the connection is closed.
+func loadSessionEnv() {
+	sessionEnvOnce.Do(func() {
+		authRefreshGrace = envDuration("AUTH_REFRESH_GRACE", 2*time.Minute)
+	})
+}
+
+// StoreSession saves user info for the connection's lifetime and schedules
+// the auth-expired push for when the token runs out.
+func StoreSession(sess easytcp.Session, userID, email, userName string, expiresAt time.Time) {
 	sessionsMu.Lock()
 	defer sessionsMu.Unlock()
-	sessions[sess.ID()] = &UserSession{
+	if old, ok := sessions[sess.ID()]; ok && old.expiryTimer != nil {
+		old.expiryTimer.Stop()
+	}
+	us := &UserSession{
 		UserID:        userID,
 		Email:         email,
 		UserName:      userName,
 		Authenticated: true,
+		ExpiresAt:     expiresAt,
+	}
+	us.expiryTimer = scheduleExpiry(sess, us)
+	sessions[sess.ID()] = us
+	ReleaseLoginGuard(sess)
+}
+
+// RefreshSession extends an existing session with a fresh token's expiry.
+// Returns false if the connection has no session for userID.
+func RefreshSession(sess easytcp.Session, userID, email, userName string, expiresAt time.Time) bool {
+	sessionsMu.RLock()
+	us, ok := sessions[sess.ID()]
+	sessionsMu.RUnlock()
+	if !ok || us.UserID != userID {
+		return false
+	}
+	StoreSession(sess, userID, email, userName, expiresAt)
+	return true
+}
+
+// scheduleExpiry arms a timer that marks the session unauthenticated and pushes
+// an auth-expired event. Unless route 11 succeeds within AUTH_REFRESH_GRACE the
+// connection is then closed. Caller must hold sessionsMu.
+func scheduleExpiry(sess easytcp.Session, us *UserSession) *time.Timer {
+	if us.ExpiresAt.IsZero() {
+		return nil
+	}
+	loadSessionEnv()
+	return time.AfterFunc(time.Until(us.ExpiresAt), func() {
+		sessionsMu.Lock()
+		// The session may have been replaced by a rename (same timer) or a refresh (new timer).
+		current, ok := sessions[sess.ID()]
+		if !ok || current.expiryTimer != us.expiryTimer {
+			sessionsMu.Unlock()
+			return
+		}
+		current.Authenticated = false
+		sessionsMu.Unlock()
+
+		log.Printf("session token expired: user=%s", us.UserID)
+		details := map[string]interface{}{"expired_at": us.ExpiresAt.UTC().Format(time.RFC3339)}
+		if authRefreshGrace > 0 {
+			details["refresh_grace_sec"] = int64(authRefreshGrace / time.Second)
+		}
+		SendToSession(sess, NewEnvelopeMessage(AuthExpiredRoute, Failure(CodeAuthExpired,
+			"session token expired, send a fresh token to re-authenticate", details)))
+
+		if authRefreshGrace > 0 {
+			time.AfterFunc(authRefreshGrace, func() { closeUnrefreshed(sess, us) })
+		}
+	})
+}
+
+// closeUnrefreshed closes the connection if the session whose token expired was
+// neither refreshed nor replaced during the grace period.
+func closeUnrefreshed(sess easytcp.Session, us *UserSession) {
+	sessionsMu.RLock()
+	current, ok := sessions[sess.ID()]
+	stale := ok && current.expiryTimer == us.expiryTimer && !current.Authenticated
+	sessionsMu.RUnlock()
+	if !stale {
+		return
+	}
+	log.Printf("closing session of %s: token not refreshed within %s", us.UserID, authRefreshGrace)
+	SendAndClose(sess, NewEnvelopeMessage(ConnectionRejectedRoute, Failure(CodeAuthExpired,
+		"session token expired and was not refreshed", nil)))
+}
+
+// SetUserName changes the display name on every session of the user and returns how
+// many were updated. Sessions are replaced rather than mutated so requests already
+// holding a *UserSession never see a half-written value.
+func SetUserName(userID, userName string) int {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	n := 0
+	for id, us := range sessions {
+		if us.UserID != userID || us.UserName == userName {
+			continue
+		}
+		renamed := *us
+		renamed.UserName = userName
+		sessions[id] = &renamed
+		n++
 	}
+	return n
 }
 
 // GetSession retrieves the user session, returns nil if not found.
@@ -42,13 +150,24 @@ func GetSession(sess easytcp.Session) *UserSession {
 func RemoveSession(sess easytcp.Session) {
 	sessionsMu.Lock()
 	defer sessionsMu.Unlock()
+	if us, ok := sessions[sess.ID()]; ok && us.expiryTimer != nil {
+		us.expiryTimer.Stop()
+	}
 	delete(sessions, sess.ID())
 }
 
-// IsAuthenticated checks if the session is authenticated.
+// IsAuthenticated checks if the session is authenticated and its token has not expired.
 func IsAuthenticated(sess easytcp.Session) bool {
 	sessionsMu.RLock()
 	defer sessionsMu.RUnlock()
-	userSession, exists := sessions[sess.ID()]
-	return exists && userSession.Authenticated
+	return authenticatedLocked(sess.ID(), time.Now())
+}
+
+// authenticatedLocked is IsAuthenticated by session ID. Caller must hold sessionsMu.
+func authenticatedLocked(id interface{}, now time.Time) bool {
+	userSession, exists := sessions[id]
+	if !exists || !userSession.Authenticated {
+		return false
+	}
+	return userSession.ExpiresAt.IsZero() || now.Before(userSession.ExpiresAt)
 }
@@ -0,0 +1,84 @@
+package services
+
+// sqliteMigrations are applied in order at boot; the index+1 is the schema version
+// recorded in schema_migrations. Never edit a shipped migration, append a new one.
+var sqliteMigrations = []string{
+	// 1: rooms, memberships, messages, profiles
+	`CREATE TABLE rooms (
+		id         TEXT PRIMARY KEY,
+		code       TEXT NOT NULL UNIQUE,
+		owner_id   TEXT NOT NULL,
+		title      TEXT NOT NULL,
+		is_private INTEGER NOT NULL DEFAULT 0,
+		created_at TEXT NOT NULL
+	);
+	CREATE TABLE room_members (
+		room_id    TEXT NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+		account_id TEXT NOT NULL,
+		role       TEXT NOT NULL DEFAULT 'member',
+		joined_at  TEXT NOT NULL,
+		PRIMARY KEY (room_id, account_id)
+	);
+	CREATE INDEX room_members_account_idx ON room_members(account_id);
+	CREATE TABLE messages (
+		id        INTEGER PRIMARY KEY AUTOINCREMENT,
+		room_id   TEXT NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+		sender_id TEXT NOT NULL,
+		body      TEXT NOT NULL,
+		type      TEXT NOT NULL DEFAULT 'text',
+		sent_at   TEXT NOT NULL
+	);
+	CREATE INDEX messages_room_sent_idx ON messages(room_id, sent_at DESC, id DESC);
+	CREATE TABLE profiles (
+		id        TEXT PRIMARY KEY,
+		user_name TEXT NOT NULL DEFAULT ''
+	);`,
+	// 2: archived rooms
+	`ALTER TABLE rooms ADD COLUMN archived_at TEXT;`,
+	// 3: message edits and tombstones
+	`ALTER TABLE messages ADD COLUMN edited_at TEXT;
+	ALTER TABLE messages ADD COLUMN deleted_at TEXT;`,
+	// 4: reactions
+	`CREATE TABLE message_reactions (
+		message_id INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+		account_id TEXT NOT NULL,
+		emoji      TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		PRIMARY KEY (message_id, account_id, emoji)
+	);`,
+	// 5: replies and threads
+	`ALTER TABLE messages ADD COLUMN reply_to_id INTEGER;
+	ALTER TABLE messages ADD COLUMN thread_root_id INTEGER;
+	CREATE INDEX messages_thread_idx ON messages(thread_root_id, id);`,
+	// 6: client message ids for idempotent sends
+	`ALTER TABLE messages ADD COLUMN client_msg_id TEXT;
+	CREATE INDEX messages_client_msg_idx ON messages(sender_id, client_msg_id) WHERE client_msg_id IS NOT NULL;`,
+	// 7: editable profiles
+	`ALTER TABLE profiles ADD COLUMN avatar_url TEXT NOT NULL DEFAULT '';
+	ALTER TABLE profiles ADD COLUMN bio TEXT NOT NULL DEFAULT '';`,
+	// 8: bans, mutes and the moderation log
+	`CREATE TABLE room_sanctions (
+		room_id    TEXT NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+		account_id TEXT NOT NULL,
+		kind       TEXT NOT NULL,
+		reason     TEXT NOT NULL,
+		created_by TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		expires_at TEXT,
+		PRIMARY KEY (room_id, account_id, kind)
+	);
+	CREATE TABLE moderation_log (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		room_id    TEXT NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+		action     TEXT NOT NULL,
+		target_id  TEXT NOT NULL,
+		actor_id   TEXT NOT NULL,
+		reason     TEXT NOT NULL,
+		expires_at TEXT,
+		created_at TEXT NOT NULL
+	);
+	CREATE INDEX moderation_log_room_idx ON moderation_log(room_id, id DESC);`,
+	// 9: room descriptions and topics
+	`ALTER TABLE rooms ADD COLUMN description TEXT NOT NULL DEFAULT '';
+	ALTER TABLE rooms ADD COLUMN topic TEXT NOT NULL DEFAULT '';`,
+}
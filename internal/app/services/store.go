@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by a Store when the requested row does not exist.
+var ErrNotFound = errors.New("not found")
+
+// Profile is a user's public profile.
+type Profile struct {
+	UserID    string `json:"user_id"`
+	UserName  string `json:"user_name"`
+	AvatarURL string `json:"avatar_url,omitempty"`
+	Bio       string `json:"bio,omitempty"`
+}
+
+// Member is one room_members row.
+type Member struct {
+	RoomID   string    `json:"room_id"`
+	UserID   string    `json:"account_id"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// Reaction is one user's emoji on a message.
+type Reaction struct {
+	MessageID int64     `json:"message_id"`
+	UserID    string    `json:"account_id"`
+	Emoji     string    `json:"emoji"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Store is the persistence backend for rooms, memberships, messages and profiles.
+// All service functions go through the active Store selected by InitStore.
+type Store interface {
+	// CreateRoom creates a room with a generated join code and adds the owner as a member.
+	CreateRoom(ctx context.Context, ownerID, title string, isPrivate bool) (*Room, error)
+	// ListRoomsByUser returns rooms the user is a member of, with their role in each.
+	ListRoomsByUser(ctx context.Context, userID string) ([]JoinedRoom, error)
+	// FindRoomByCode returns the room with the given join code or ErrNotFound.
+	FindRoomByCode(ctx context.Context, code string) (*Room, error)
+	// GetRoom returns the room with the given id or ErrNotFound.
+	GetRoom(ctx context.Context, roomID string) (*Room, error)
+	// UpdateRoom writes the room's title, privacy, description, topic and archived_at;
+	// ErrNotFound if it does not exist.
+	UpdateRoom(ctx context.Context, room *Room) error
+	// DeleteRoom deletes the room with its memberships, messages, reactions, sanctions
+	// and moderation log; ErrNotFound if it does not exist.
+	DeleteRoom(ctx context.Context, roomID string) error
+	// AddMember inserts a membership and reports whether a row was added; adding an
+	// existing member is not an error and leaves their role unchanged.
+	AddMember(ctx context.Context, roomID, userID, role string) (bool, error)
+	// GetMemberRole returns the user's role in the room, or ErrNotFound if they are not a member.
+	GetMemberRole(ctx context.Context, roomID, userID string) (string, error)
+	// RemoveMember deletes a membership, or returns ErrNotFound if the user is not a member.
+	RemoveMember(ctx context.Context, roomID, userID string) error
+	// SetMemberRole changes a member's role, or returns ErrNotFound if they are not a member.
+	SetMemberRole(ctx context.Context, roomID, userID, role string) error
+	// ListMembers returns the room's members, earliest joined first.
+	ListMembers(ctx context.Context, roomID string) ([]Member, error)
+	// TransferOwnership makes newOwnerID the room's owner (rooms.owner_id and their member role).
+	TransferOwnership(ctx context.Context, roomID, newOwnerID string) error
+	// ArchiveRoom marks the room archived; ErrNotFound if it does not exist.
+	ArchiveRoom(ctx context.Context, roomID string) error
+
+	// CreateMessage inserts a text message built from the draft's RoomID, SenderID, Body
+	// and optional ReplyToID/ThreadRootID/ClientMsgID, and returns the saved row.
+	CreateMessage(ctx context.Context, draft *Message) (*Message, error)
+	// ListMessages returns up to q.Limit+1 messages newest-first (oldest-first when
+	// q.AfterID is set) so callers can detect more pages.
+	ListMessages(ctx context.Context, q MessageQuery) ([]Message, error)
+	// FindMessageByClientID returns the sender's earliest message with clientMsgID sent
+	// at or after since, or ErrNotFound.
+	FindMessageByClientID(ctx context.Context, senderID, clientMsgID string, since time.Time) (*Message, error)
+	// GetMessage returns a single message or ErrNotFound.
+	GetMessage(ctx context.Context, id int64) (*Message, error)
+	// GetMessages returns the messages that exist among ids, in no particular order.
+	GetMessages(ctx context.Context, ids []int64) ([]Message, error)
+	// CountReplies returns the number of undeleted thread replies per root message.
+	CountReplies(ctx context.Context, rootIDs []int64) (map[int64]int, error)
+	// EditMessage replaces the body and stamps edited_at; returns the updated row or ErrNotFound.
+	EditMessage(ctx context.Context, id int64, body string) (*Message, error)
+	// DeleteMessage tombstones the message (clears the body, stamps deleted_at once);
+	// returns the updated row or ErrNotFound.
+	DeleteMessage(ctx context.Context, id int64) (*Message, error)
+
+	// AddReaction records a user's emoji on a message; returns false if it already existed.
+	AddReaction(ctx context.Context, messageID int64, userID, emoji string) (bool, error)
+	// RemoveReaction deletes a user's emoji from a message; returns false if it was not there.
+	RemoveReaction(ctx context.Context, messageID int64, userID, emoji string) (bool, error)
+	// ListReactions returns all reactions on the given messages, oldest first.
+	ListReactions(ctx context.Context, messageIDs []int64) ([]Reaction, error)
+
+	// PutSanction records a ban or mute, replacing the user's earlier one of the same kind.
+	PutSanction(ctx context.Context, s *Sanction) error
+	// GetSanction returns the user's ban or mute in the room (even if expired) or ErrNotFound.
+	GetSanction(ctx context.Context, roomID, userID, kind string) (*Sanction, error)
+	// DeleteSanction lifts a ban or mute; returns false if there was none.
+	DeleteSanction(ctx context.Context, roomID, userID, kind string) (bool, error)
+	// AddModerationEntry appends to the room's moderation log and returns the saved row.
+	AddModerationEntry(ctx context.Context, e *ModerationEntry) (*ModerationEntry, error)
+	// ListModerationLog returns up to limit+1 log entries newest-first, older than
+	// beforeID when it is non-zero.
+	ListModerationLog(ctx context.Context, roomID string, beforeID int64, limit int) ([]ModerationEntry, error)
+
+	// GetProfiles returns the profiles that exist among userIDs, in no particular order.
+	GetProfiles(ctx context.Context, userIDs []string) ([]Profile, error)
+	// EnsureProfile creates the profile from login data unless the user already has one.
+	EnsureProfile(ctx context.Context, p *Profile) error
+	// UpdateProfile writes the user's name, avatar URL and bio, creating the profile if needed.
+	UpdateProfile(ctx context.Context, p *Profile) error
+}
+
+var (
+	store            Store
+	defaultStoreOnce sync.Once
+)
+
+// InitStore selects the storage backend by name ("supabase", "memory" or "sqlite").
+// An empty name defaults to supabase. The sqlite backend reads its file path from SQLITE_PATH.
+func InitStore(backend string) error {
+	switch strings.ToLower(strings.TrimSpace(backend)) {
+	case "", "supabase":
+		store = newSupabaseStore()
+	case "memory":
+		store = newMemoryStore()
+	case "sqlite":
+		s, err := newSQLiteStore(os.Getenv("SQLITE_PATH"))
+		if err != nil {
+			return err
+		}
+		store = s
+	default:
+		return fmt.Errorf("unknown store backend %q", backend)
+	}
+	return nil
+}
+
+// SetStore replaces the active backend (useful for tests and embedding). Like InitStore,
+// call it before the server starts handling requests.
+func SetStore(s Store) {
+	store = s
+}
+
+// currentStore returns the active backend, defaulting to supabase when InitStore was not called.
+// The default is assigned once, so concurrent first calls share one backend.
+func currentStore() Store {
+	defaultStoreOnce.Do(func() {
+		if store == nil {
+			store = newSupabaseStore()
+		}
+	})
+	return store
+}
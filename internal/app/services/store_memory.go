@@ -0,0 +1,596 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// roomCodeAlphabet avoids look-alike characters (0/O, 1/I) in generated join codes.
+const roomCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// memoryStore implements Store in process memory. Data is lost on restart;
+// it exists so the server can run locally and in CI without Supabase.
+type memoryStore struct {
+	mu       sync.RWMutex
+	rooms    map[string]*Room
+	members  map[string]map[string]Member // room_id -> account_id -> membership
+	messages []Message
+	profiles map[string]Profile
+	// reactions is kept in insertion order so listings come out oldest first.
+	reactions []Reaction
+	// sanctions is keyed by room_id|account_id|kind.
+	sanctions     map[string]Sanction
+	moderationLog []ModerationEntry
+	nextRoom      int64
+	nextMsg       int64
+	nextModEntry  int64
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		rooms:     make(map[string]*Room),
+		members:   make(map[string]map[string]Member),
+		profiles:  make(map[string]Profile),
+		sanctions: make(map[string]Sanction),
+	}
+}
+
+// generateRoomCode returns a random join code of length n.
+func generateRoomCode(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	for i, b := range buf {
+		buf[i] = roomCodeAlphabet[int(b)%len(roomCodeAlphabet)]
+	}
+	return string(buf), nil
+}
+
+func (m *memoryStore) CreateRoom(ctx context.Context, ownerID, title string, isPrivate bool) (*Room, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var code string
+	for {
+		c, err := generateRoomCode(6)
+		if err != nil {
+			return nil, fmt.Errorf("generate room code: %w", err)
+		}
+		if m.roomByCodeLocked(c) == nil {
+			code = c
+			break
+		}
+	}
+
+	m.nextRoom++
+	room := &Room{
+		ID:        fmt.Sprintf("room-%d", m.nextRoom),
+		Code:      code,
+		OwnerID:   ownerID,
+		Title:     title,
+		IsPrivate: isPrivate,
+		CreatedAt: time.Now().UTC(),
+	}
+	m.rooms[room.ID] = room
+	m.members[room.ID] = map[string]Member{
+		ownerID: {RoomID: room.ID, UserID: ownerID, Role: "owner", JoinedAt: room.CreatedAt},
+	}
+
+	r := *room
+	return &r, nil
+}
+
+func (m *memoryStore) ListRoomsByUser(ctx context.Context, userID string) ([]JoinedRoom, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rooms := make([]JoinedRoom, 0)
+	for roomID, members := range m.members {
+		if member, ok := members[userID]; ok {
+			rooms = append(rooms, JoinedRoom{Room: *m.rooms[roomID], Role: member.Role})
+		}
+	}
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].CreatedAt.Before(rooms[j].CreatedAt) })
+	return rooms, nil
+}
+
+func (m *memoryStore) FindRoomByCode(ctx context.Context, code string) (*Room, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	room := m.roomByCodeLocked(code)
+	if room == nil {
+		return nil, ErrNotFound
+	}
+	r := *room
+	return &r, nil
+}
+
+func (m *memoryStore) GetRoom(ctx context.Context, roomID string) (*Room, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	room, ok := m.rooms[roomID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	r := *room
+	return &r, nil
+}
+
+func (m *memoryStore) UpdateRoom(ctx context.Context, room *Room) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cur, ok := m.rooms[room.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	cur.Title = room.Title
+	cur.IsPrivate = room.IsPrivate
+	cur.Description = room.Description
+	cur.Topic = room.Topic
+	cur.ArchivedAt = room.ArchivedAt
+	return nil
+}
+
+func (m *memoryStore) DeleteRoom(ctx context.Context, roomID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.rooms[roomID]; !ok {
+		return ErrNotFound
+	}
+	delete(m.rooms, roomID)
+	delete(m.members, roomID)
+
+	deleted := make(map[int64]bool)
+	msgs := m.messages[:0]
+	for _, msg := range m.messages {
+		if msg.RoomID == roomID {
+			deleted[msg.ID] = true
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+	m.messages = msgs
+
+	reactions := m.reactions[:0]
+	for _, r := range m.reactions {
+		if !deleted[r.MessageID] {
+			reactions = append(reactions, r)
+		}
+	}
+	m.reactions = reactions
+
+	for key, sn := range m.sanctions {
+		if sn.RoomID == roomID {
+			delete(m.sanctions, key)
+		}
+	}
+	log := m.moderationLog[:0]
+	for _, e := range m.moderationLog {
+		if e.RoomID != roomID {
+			log = append(log, e)
+		}
+	}
+	m.moderationLog = log
+	return nil
+}
+
+func (m *memoryStore) roomByCodeLocked(code string) *Room {
+	for _, room := range m.rooms {
+		if room.Code == code {
+			return room
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) AddMember(ctx context.Context, roomID, userID, role string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.rooms[roomID]; !ok {
+		return false, ErrNotFound
+	}
+	if _, exists := m.members[roomID][userID]; exists {
+		return false, nil
+	}
+	m.members[roomID][userID] = Member{RoomID: roomID, UserID: userID, Role: role, JoinedAt: time.Now().UTC()}
+	return true, nil
+}
+
+func (m *memoryStore) GetMemberRole(ctx context.Context, roomID, userID string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	member, ok := m.members[roomID][userID]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return member.Role, nil
+}
+
+func (m *memoryStore) RemoveMember(ctx context.Context, roomID, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.members[roomID][userID]; !ok {
+		return ErrNotFound
+	}
+	delete(m.members[roomID], userID)
+	return nil
+}
+
+func (m *memoryStore) ListMembers(ctx context.Context, roomID string) ([]Member, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	members := make([]Member, 0, len(m.members[roomID]))
+	for _, member := range m.members[roomID] {
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if !members[i].JoinedAt.Equal(members[j].JoinedAt) {
+			return members[i].JoinedAt.Before(members[j].JoinedAt)
+		}
+		return members[i].UserID < members[j].UserID
+	})
+	return members, nil
+}
+
+func (m *memoryStore) SetMemberRole(ctx context.Context, roomID, userID, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	member, ok := m.members[roomID][userID]
+	if !ok {
+		return ErrNotFound
+	}
+	member.Role = role
+	m.members[roomID][userID] = member
+	return nil
+}
+
+func (m *memoryStore) TransferOwnership(ctx context.Context, roomID, newOwnerID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	member, ok := m.members[roomID][newOwnerID]
+	if !ok {
+		return ErrNotFound
+	}
+	member.Role = "owner"
+	m.members[roomID][newOwnerID] = member
+	m.rooms[roomID].OwnerID = newOwnerID
+	return nil
+}
+
+func (m *memoryStore) ArchiveRoom(ctx context.Context, roomID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	room, ok := m.rooms[roomID]
+	if !ok {
+		return ErrNotFound
+	}
+	if room.ArchivedAt == nil {
+		now := time.Now().UTC()
+		room.ArchivedAt = &now
+	}
+	return nil
+}
+
+func (m *memoryStore) CreateMessage(ctx context.Context, draft *Message) (*Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.rooms[draft.RoomID]; !ok {
+		return nil, ErrNotFound
+	}
+	m.nextMsg++
+	msg := Message{
+		ID:           m.nextMsg,
+		RoomID:       draft.RoomID,
+		SenderID:     draft.SenderID,
+		Body:         draft.Body,
+		Type:         "text",
+		SentAt:       time.Now().UTC(),
+		ReplyToID:    draft.ReplyToID,
+		ThreadRootID: draft.ThreadRootID,
+		ClientMsgID:  draft.ClientMsgID,
+	}
+	m.messages = append(m.messages, msg)
+	return &msg, nil
+}
+
+func (m *memoryStore) ListMessages(ctx context.Context, q MessageQuery) ([]Message, error) {
+	var before int64
+	if q.BeforeID != "" {
+		id, err := strconv.ParseInt(q.BeforeID, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid before_id %q", q.BeforeID)
+		}
+		before = id
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	match := func(msg Message) bool {
+		if msg.RoomID != q.RoomID || msg.ThreadRootID != q.ThreadRootID {
+			return false
+		}
+		if before != 0 && msg.ID >= before {
+			return false
+		}
+		if !q.BeforeCreatedAt.IsZero() && !msg.SentAt.Before(q.BeforeCreatedAt) {
+			return false
+		}
+		return q.IncludeSystem || msg.Type == "text"
+	}
+
+	rows := make([]Message, 0, q.Limit+1)
+	if q.AfterID != 0 {
+		// Forward pages run oldest-first from the first message after the cursor.
+		start := sort.Search(len(m.messages), func(i int) bool { return m.messages[i].ID > q.AfterID })
+		for i := start; i < len(m.messages) && len(rows) <= q.Limit; i++ {
+			if match(m.messages[i]) {
+				rows = append(rows, m.messages[i])
+			}
+		}
+		return rows, nil
+	}
+
+	// messages is append-only with increasing IDs, so walk it backwards for newest-first.
+	for i := len(m.messages) - 1; i >= 0 && len(rows) <= q.Limit; i-- {
+		if match(m.messages[i]) {
+			rows = append(rows, m.messages[i])
+		}
+	}
+	return rows, nil
+}
+
+// messageIndexLocked returns the slice index of message id, or -1. Caller must hold mu.
+func (m *memoryStore) messageIndexLocked(id int64) int {
+	// IDs are assigned in append order, so binary search works.
+	i := sort.Search(len(m.messages), func(i int) bool { return m.messages[i].ID >= id })
+	if i < len(m.messages) && m.messages[i].ID == id {
+		return i
+	}
+	return -1
+}
+
+func (m *memoryStore) GetMessage(ctx context.Context, id int64) (*Message, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	i := m.messageIndexLocked(id)
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	msg := m.messages[i]
+	return &msg, nil
+}
+
+func (m *memoryStore) FindMessageByClientID(ctx context.Context, senderID, clientMsgID string, since time.Time) (*Message, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, msg := range m.messages {
+		if msg.SenderID == senderID && msg.ClientMsgID == clientMsgID && !msg.SentAt.Before(since) {
+			return &msg, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *memoryStore) GetMessages(ctx context.Context, ids []int64) ([]Message, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	msgs := make([]Message, 0, len(ids))
+	for _, id := range ids {
+		if i := m.messageIndexLocked(id); i >= 0 {
+			msgs = append(msgs, m.messages[i])
+		}
+	}
+	return msgs, nil
+}
+
+func (m *memoryStore) CountReplies(ctx context.Context, rootIDs []int64) (map[int64]int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	want := make(map[int64]bool, len(rootIDs))
+	for _, id := range rootIDs {
+		want[id] = true
+	}
+	counts := make(map[int64]int)
+	for _, msg := range m.messages {
+		if msg.ThreadRootID != 0 && want[msg.ThreadRootID] && msg.DeletedAt == nil {
+			counts[msg.ThreadRootID]++
+		}
+	}
+	return counts, nil
+}
+
+func (m *memoryStore) EditMessage(ctx context.Context, id int64, body string) (*Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.messageIndexLocked(id)
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	now := time.Now().UTC()
+	m.messages[i].Body = body
+	m.messages[i].EditedAt = &now
+	msg := m.messages[i]
+	return &msg, nil
+}
+
+func (m *memoryStore) DeleteMessage(ctx context.Context, id int64) (*Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.messageIndexLocked(id)
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	m.messages[i].Body = ""
+	if m.messages[i].DeletedAt == nil {
+		now := time.Now().UTC()
+		m.messages[i].DeletedAt = &now
+	}
+	msg := m.messages[i]
+	return &msg, nil
+}
+
+func (m *memoryStore) reactionIndexLocked(messageID int64, userID, emoji string) int {
+	for i, r := range m.reactions {
+		if r.MessageID == messageID && r.UserID == userID && r.Emoji == emoji {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *memoryStore) AddReaction(ctx context.Context, messageID int64, userID, emoji string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.messageIndexLocked(messageID) < 0 {
+		return false, ErrNotFound
+	}
+	if m.reactionIndexLocked(messageID, userID, emoji) >= 0 {
+		return false, nil
+	}
+	m.reactions = append(m.reactions, Reaction{MessageID: messageID, UserID: userID, Emoji: emoji, CreatedAt: time.Now().UTC()})
+	return true, nil
+}
+
+func (m *memoryStore) RemoveReaction(ctx context.Context, messageID int64, userID, emoji string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.reactionIndexLocked(messageID, userID, emoji)
+	if i < 0 {
+		return false, nil
+	}
+	m.reactions = append(m.reactions[:i], m.reactions[i+1:]...)
+	return true, nil
+}
+
+func (m *memoryStore) ListReactions(ctx context.Context, messageIDs []int64) ([]Reaction, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	want := make(map[int64]bool, len(messageIDs))
+	for _, id := range messageIDs {
+		want[id] = true
+	}
+	reactions := make([]Reaction, 0)
+	for _, r := range m.reactions {
+		if want[r.MessageID] {
+			reactions = append(reactions, r)
+		}
+	}
+	return reactions, nil
+}
+
+func sanctionKey(roomID, userID, kind string) string {
+	return roomID + "|" + userID + "|" + kind
+}
+
+func (m *memoryStore) PutSanction(ctx context.Context, sn *Sanction) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sanctions[sanctionKey(sn.RoomID, sn.UserID, sn.Kind)] = *sn
+	return nil
+}
+
+func (m *memoryStore) GetSanction(ctx context.Context, roomID, userID, kind string) (*Sanction, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sn, ok := m.sanctions[sanctionKey(roomID, userID, kind)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &sn, nil
+}
+
+func (m *memoryStore) DeleteSanction(ctx context.Context, roomID, userID, kind string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := sanctionKey(roomID, userID, kind)
+	if _, ok := m.sanctions[key]; !ok {
+		return false, nil
+	}
+	delete(m.sanctions, key)
+	return true, nil
+}
+
+func (m *memoryStore) AddModerationEntry(ctx context.Context, e *ModerationEntry) (*ModerationEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextModEntry++
+	saved := *e
+	saved.ID = m.nextModEntry
+	m.moderationLog = append(m.moderationLog, saved)
+	return &saved, nil
+}
+
+func (m *memoryStore) ListModerationLog(ctx context.Context, roomID string, beforeID int64, limit int) ([]ModerationEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entries := make([]ModerationEntry, 0)
+	for i := len(m.moderationLog) - 1; i >= 0 && len(entries) <= limit; i-- {
+		e := m.moderationLog[i]
+		if e.RoomID != roomID || (beforeID > 0 && e.ID >= beforeID) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func (m *memoryStore) GetProfiles(ctx context.Context, userIDs []string) ([]Profile, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	profiles := make([]Profile, 0, len(userIDs))
+	for _, id := range userIDs {
+		if p, ok := m.profiles[id]; ok {
+			profiles = append(profiles, p)
+		}
+	}
+	return profiles, nil
+}
+
+func (m *memoryStore) EnsureProfile(ctx context.Context, p *Profile) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.profiles[p.UserID]; !ok {
+		m.profiles[p.UserID] = *p
+	}
+	return nil
+}
+
+func (m *memoryStore) UpdateProfile(ctx context.Context, p *Profile) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.profiles[p.UserID] = *p
+	return nil
+}
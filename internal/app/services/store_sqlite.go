@@ -0,0 +1,760 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	_ "modernc.org/sqlite" // registers the "sqlite" database/sql driver
+)
+
+// sqliteTimeLayout is fixed-width so TEXT timestamps sort chronologically.
+const sqliteTimeLayout = "2006-01-02T15:04:05.000000Z"
+
+// sqliteStore implements Store on an embedded SQLite database file.
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// newSQLiteStore opens (or creates) the database at path and applies pending migrations.
+func newSQLiteStore(path string) (*sqliteStore, error) {
+	if path == "" {
+		path = "musick.db"
+	}
+	dsn := "file:" + path + "?" + url.Values{
+		"_pragma": {"foreign_keys(1)", "busy_timeout(5000)", "journal_mode(WAL)"},
+	}.Encode()
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite %s: %w", path, err)
+	}
+	// SQLite allows a single writer; one connection avoids SQLITE_BUSY between our own goroutines.
+	db.SetMaxOpenConns(1)
+
+	s := &sqliteStore{db: db}
+	if err := s.migrate(context.Background()); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// migrate applies every migration newer than the recorded schema version, each in its own transaction.
+func (s *sqliteStore) migrate(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TEXT NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	var current int
+	if err := s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+
+	for i := current; i < len(sqliteMigrations); i++ {
+		version := i + 1
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, sqliteMigrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("apply migration %d: %w", version, err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`,
+			version, formatSQLiteTime(time.Now())); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("record migration %d: %w", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("commit migration %d: %w", version, err)
+		}
+	}
+	return nil
+}
+
+func formatSQLiteTime(t time.Time) string {
+	return t.UTC().Format(sqliteTimeLayout)
+}
+
+func parseSQLiteTime(v string) time.Time {
+	t, _ := time.Parse(sqliteTimeLayout, v)
+	return t
+}
+
+// scanner is satisfied by *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+const sqliteRoomColumns = `r.id, r.code, r.owner_id, r.title, r.is_private, r.description, r.topic, r.created_at, r.archived_at`
+
+// extraColumns scans columns selected after a fixed column list into extra.
+type extraColumns struct {
+	scanner
+	extra []interface{}
+}
+
+func (e extraColumns) Scan(dest ...interface{}) error {
+	return e.scanner.Scan(append(dest, e.extra...)...)
+}
+
+func scanRoom(row scanner) (*Room, error) {
+	var (
+		room       Room
+		createdAt  string
+		archivedAt sql.NullString
+	)
+	if err := row.Scan(&room.ID, &room.Code, &room.OwnerID, &room.Title, &room.IsPrivate, &room.Description, &room.Topic,
+		&createdAt, &archivedAt); err != nil {
+		return nil, err
+	}
+	room.CreatedAt = parseSQLiteTime(createdAt)
+	room.ArchivedAt = parseNullSQLiteTime(archivedAt)
+	return &room, nil
+}
+
+// CreateRoom mirrors the create_room_with_owner RPC: generate a unique code, insert the room and the owner membership.
+func (s *sqliteStore) CreateRoom(ctx context.Context, ownerID, title string, isPrivate bool) (*Room, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin create room: %w", err)
+	}
+	defer tx.Rollback()
+
+	room := &Room{
+		ID:        uuid.NewString(),
+		OwnerID:   ownerID,
+		Title:     title,
+		IsPrivate: isPrivate,
+		CreatedAt: time.Now().UTC(),
+	}
+	for attempt := 0; ; attempt++ {
+		code, err := generateRoomCode(6)
+		if err != nil {
+			return nil, fmt.Errorf("generate room code: %w", err)
+		}
+		var taken int
+		if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM rooms WHERE code = ?`, code).Scan(&taken); err != nil {
+			return nil, fmt.Errorf("check room code: %w", err)
+		}
+		if taken == 0 {
+			room.Code = code
+			break
+		}
+		if attempt >= 10 {
+			return nil, fmt.Errorf("could not generate a unique room code")
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO rooms (id, code, owner_id, title, is_private, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		room.ID, room.Code, room.OwnerID, room.Title, room.IsPrivate, formatSQLiteTime(room.CreatedAt)); err != nil {
+		return nil, fmt.Errorf("insert room: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO room_members (room_id, account_id, role, joined_at) VALUES (?, ?, 'owner', ?)`,
+		room.ID, ownerID, formatSQLiteTime(room.CreatedAt)); err != nil {
+		return nil, fmt.Errorf("insert owner membership: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit create room: %w", err)
+	}
+	return room, nil
+}
+
+func (s *sqliteStore) ListRoomsByUser(ctx context.Context, userID string) ([]JoinedRoom, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+sqliteRoomColumns+`, m.role
+		FROM rooms r JOIN room_members m ON m.room_id = r.id
+		WHERE m.account_id = ?
+		ORDER BY r.created_at`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch rooms: %w", err)
+	}
+	defer rows.Close()
+
+	rooms := make([]JoinedRoom, 0)
+	for rows.Next() {
+		var role string
+		room, err := scanRoom(extraColumns{rows, []interface{}{&role}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode rooms: %w", err)
+		}
+		rooms = append(rooms, JoinedRoom{Room: *room, Role: role})
+	}
+	return rooms, rows.Err()
+}
+
+func (s *sqliteStore) FindRoomByCode(ctx context.Context, code string) (*Room, error) {
+	room, err := scanRoom(s.db.QueryRowContext(ctx, `SELECT `+sqliteRoomColumns+` FROM rooms r WHERE r.code = ?`, code))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lookup room by code: %w", err)
+	}
+	return room, nil
+}
+
+func (s *sqliteStore) GetRoom(ctx context.Context, roomID string) (*Room, error) {
+	room, err := scanRoom(s.db.QueryRowContext(ctx, `SELECT `+sqliteRoomColumns+` FROM rooms r WHERE r.id = ?`, roomID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lookup room: %w", err)
+	}
+	return room, nil
+}
+
+func (s *sqliteStore) UpdateRoom(ctx context.Context, room *Room) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE rooms SET title = ?, is_private = ?, description = ?, topic = ?, archived_at = ? WHERE id = ?`,
+		room.Title, room.IsPrivate, room.Description, room.Topic, nullTime(room.ArchivedAt), room.ID)
+	if err != nil {
+		return fmt.Errorf("update room: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteRoom relies on ON DELETE CASCADE for the room's rows; reactions cascade from messages.
+func (s *sqliteStore) DeleteRoom(ctx context.Context, roomID string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM rooms WHERE id = ?`, roomID)
+	if err != nil {
+		return fmt.Errorf("delete room: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqliteStore) AddMember(ctx context.Context, roomID, userID, role string) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO room_members (room_id, account_id, role, joined_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (room_id, account_id) DO NOTHING`,
+		roomID, userID, role, formatSQLiteTime(time.Now()))
+	if err != nil {
+		return false, fmt.Errorf("insert membership: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func (s *sqliteStore) GetMemberRole(ctx context.Context, roomID, userID string) (string, error) {
+	var role string
+	err := s.db.QueryRowContext(ctx, `SELECT role FROM room_members WHERE room_id = ? AND account_id = ?`, roomID, userID).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("lookup membership: %w", err)
+	}
+	return role, nil
+}
+
+func (s *sqliteStore) RemoveMember(ctx context.Context, roomID, userID string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM room_members WHERE room_id = ? AND account_id = ?`, roomID, userID)
+	if err != nil {
+		return fmt.Errorf("delete membership: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqliteStore) SetMemberRole(ctx context.Context, roomID, userID, role string) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE room_members SET role = ? WHERE room_id = ? AND account_id = ?`, role, roomID, userID)
+	if err != nil {
+		return fmt.Errorf("update member role: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqliteStore) ListMembers(ctx context.Context, roomID string) ([]Member, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT room_id, account_id, role, joined_at FROM room_members WHERE room_id = ? ORDER BY joined_at, account_id`, roomID)
+	if err != nil {
+		return nil, fmt.Errorf("list members: %w", err)
+	}
+	defer rows.Close()
+
+	members := make([]Member, 0)
+	for rows.Next() {
+		var (
+			m        Member
+			joinedAt string
+		)
+		if err := rows.Scan(&m.RoomID, &m.UserID, &m.Role, &joinedAt); err != nil {
+			return nil, fmt.Errorf("decode members: %w", err)
+		}
+		m.JoinedAt = parseSQLiteTime(joinedAt)
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+func (s *sqliteStore) TransferOwnership(ctx context.Context, roomID, newOwnerID string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `UPDATE room_members SET role = 'owner' WHERE room_id = ? AND account_id = ?`, roomID, newOwnerID)
+	if err != nil {
+		return fmt.Errorf("promote new owner: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE rooms SET owner_id = ? WHERE id = ?`, newOwnerID, roomID); err != nil {
+		return fmt.Errorf("update room owner: %w", err)
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) ArchiveRoom(ctx context.Context, roomID string) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE rooms SET archived_at = COALESCE(archived_at, ?) WHERE id = ?`,
+		formatSQLiteTime(time.Now()), roomID)
+	if err != nil {
+		return fmt.Errorf("archive room: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+const sqliteMessageColumns = `id, room_id, sender_id, body, type, sent_at, edited_at, deleted_at, reply_to_id, thread_root_id, client_msg_id`
+
+func scanMessage(row scanner) (*Message, error) {
+	var (
+		msg                 Message
+		sentAt              string
+		editedAt, deletedAt sql.NullString
+		replyTo, threadRoot sql.NullInt64
+		clientMsgID         sql.NullString
+	)
+	if err := row.Scan(&msg.ID, &msg.RoomID, &msg.SenderID, &msg.Body, &msg.Type, &sentAt, &editedAt, &deletedAt,
+		&replyTo, &threadRoot, &clientMsgID); err != nil {
+		return nil, err
+	}
+	msg.ClientMsgID = clientMsgID.String
+	msg.SentAt = parseSQLiteTime(sentAt)
+	msg.ReplyToID = replyTo.Int64
+	msg.ThreadRootID = threadRoot.Int64
+	msg.EditedAt = parseNullSQLiteTime(editedAt)
+	msg.DeletedAt = parseNullSQLiteTime(deletedAt)
+	return &msg, nil
+}
+
+func parseNullSQLiteTime(v sql.NullString) *time.Time {
+	if !v.Valid {
+		return nil
+	}
+	t := parseSQLiteTime(v.String)
+	return &t
+}
+
+// nullID stores 0 as NULL for optional message references.
+func nullID(id int64) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// sqlitePlaceholders returns "?, ?, ..." and the args for an IN list of ids.
+func sqlitePlaceholders[T int64 | string](ids []T) (string, []interface{}) {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return "?" + strings.Repeat(", ?", len(ids)-1), args
+}
+
+func (s *sqliteStore) CreateMessage(ctx context.Context, draft *Message) (*Message, error) {
+	sentAt := time.Now().UTC()
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO messages (room_id, sender_id, body, type, sent_at, reply_to_id, thread_root_id, client_msg_id)
+		VALUES (?, ?, ?, 'text', ?, ?, ?, ?)`,
+		draft.RoomID, draft.SenderID, draft.Body, formatSQLiteTime(sentAt), nullID(draft.ReplyToID), nullID(draft.ThreadRootID),
+		sql.NullString{String: draft.ClientMsgID, Valid: draft.ClientMsgID != ""})
+	if err != nil {
+		return nil, fmt.Errorf("send message: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("read message id: %w", err)
+	}
+	return &Message{
+		ID:           id,
+		RoomID:       draft.RoomID,
+		SenderID:     draft.SenderID,
+		Body:         draft.Body,
+		Type:         "text",
+		SentAt:       parseSQLiteTime(formatSQLiteTime(sentAt)),
+		ReplyToID:    draft.ReplyToID,
+		ThreadRootID: draft.ThreadRootID,
+		ClientMsgID:  draft.ClientMsgID,
+	}, nil
+}
+
+func (s *sqliteStore) FindMessageByClientID(ctx context.Context, senderID, clientMsgID string, since time.Time) (*Message, error) {
+	msg, err := scanMessage(s.db.QueryRowContext(ctx, `SELECT `+sqliteMessageColumns+` FROM messages
+		WHERE sender_id = ? AND client_msg_id = ? AND sent_at >= ?
+		ORDER BY id LIMIT 1`, senderID, clientMsgID, formatSQLiteTime(since)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lookup message by client id: %w", err)
+	}
+	return msg, nil
+}
+
+func (s *sqliteStore) ListMessages(ctx context.Context, q MessageQuery) ([]Message, error) {
+	where := []string{"room_id = ?"}
+	args := []interface{}{q.RoomID}
+	if q.BeforeID != "" {
+		id, err := strconv.ParseInt(q.BeforeID, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid before_id %q", q.BeforeID)
+		}
+		where = append(where, "id < ?")
+		args = append(args, id)
+	}
+	order := "sent_at DESC, id DESC"
+	if q.AfterID != 0 {
+		where = append(where, "id > ?")
+		args = append(args, q.AfterID)
+		order = "sent_at, id"
+	}
+	if !q.BeforeCreatedAt.IsZero() {
+		where = append(where, "sent_at < ?")
+		args = append(args, formatSQLiteTime(q.BeforeCreatedAt))
+	}
+	if !q.IncludeSystem {
+		where = append(where, "type = 'text'")
+	}
+	if q.ThreadRootID != 0 {
+		where = append(where, "thread_root_id = ?")
+		args = append(args, q.ThreadRootID)
+	} else {
+		where = append(where, "thread_root_id IS NULL")
+	}
+	limit := q.Limit
+	args = append(args, limit+1)
+
+	rows, err := s.db.QueryContext(ctx, `SELECT `+sqliteMessageColumns+` FROM messages
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY `+order+` LIMIT ?`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("fetch messages: %w", err)
+	}
+	defer rows.Close()
+
+	msgs := make([]Message, 0, limit+1)
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("decode messages: %w", err)
+		}
+		msgs = append(msgs, *msg)
+	}
+	return msgs, rows.Err()
+}
+
+func (s *sqliteStore) GetMessage(ctx context.Context, id int64) (*Message, error) {
+	msg, err := scanMessage(s.db.QueryRowContext(ctx, `SELECT `+sqliteMessageColumns+` FROM messages WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lookup message: %w", err)
+	}
+	return msg, nil
+}
+
+func (s *sqliteStore) GetMessages(ctx context.Context, ids []int64) ([]Message, error) {
+	msgs := make([]Message, 0, len(ids))
+	if len(ids) == 0 {
+		return msgs, nil
+	}
+	in, args := sqlitePlaceholders(ids)
+	rows, err := s.db.QueryContext(ctx, `SELECT `+sqliteMessageColumns+` FROM messages WHERE id IN (`+in+`)`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("lookup messages: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("decode messages: %w", err)
+		}
+		msgs = append(msgs, *msg)
+	}
+	return msgs, rows.Err()
+}
+
+func (s *sqliteStore) CountReplies(ctx context.Context, rootIDs []int64) (map[int64]int, error) {
+	counts := make(map[int64]int)
+	if len(rootIDs) == 0 {
+		return counts, nil
+	}
+	in, args := sqlitePlaceholders(rootIDs)
+	rows, err := s.db.QueryContext(ctx, `SELECT thread_root_id, COUNT(*) FROM messages
+		WHERE thread_root_id IN (`+in+`) AND deleted_at IS NULL
+		GROUP BY thread_root_id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("count replies: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			root int64
+			n    int
+		)
+		if err := rows.Scan(&root, &n); err != nil {
+			return nil, fmt.Errorf("decode reply counts: %w", err)
+		}
+		counts[root] = n
+	}
+	return counts, rows.Err()
+}
+
+func (s *sqliteStore) EditMessage(ctx context.Context, id int64, body string) (*Message, error) {
+	res, err := s.db.ExecContext(ctx, `UPDATE messages SET body = ?, edited_at = ? WHERE id = ?`,
+		body, formatSQLiteTime(time.Now()), id)
+	if err != nil {
+		return nil, fmt.Errorf("edit message: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrNotFound
+	}
+	return s.GetMessage(ctx, id)
+}
+
+func (s *sqliteStore) DeleteMessage(ctx context.Context, id int64) (*Message, error) {
+	res, err := s.db.ExecContext(ctx, `UPDATE messages SET body = '', deleted_at = COALESCE(deleted_at, ?) WHERE id = ?`,
+		formatSQLiteTime(time.Now()), id)
+	if err != nil {
+		return nil, fmt.Errorf("delete message: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrNotFound
+	}
+	return s.GetMessage(ctx, id)
+}
+
+func (s *sqliteStore) AddReaction(ctx context.Context, messageID int64, userID, emoji string) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO message_reactions (message_id, account_id, emoji, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (message_id, account_id, emoji) DO NOTHING`,
+		messageID, userID, emoji, formatSQLiteTime(time.Now()))
+	if err != nil {
+		return false, fmt.Errorf("add reaction: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func (s *sqliteStore) RemoveReaction(ctx context.Context, messageID int64, userID, emoji string) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		`DELETE FROM message_reactions WHERE message_id = ? AND account_id = ? AND emoji = ?`,
+		messageID, userID, emoji)
+	if err != nil {
+		return false, fmt.Errorf("remove reaction: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func (s *sqliteStore) ListReactions(ctx context.Context, messageIDs []int64) ([]Reaction, error) {
+	reactions := make([]Reaction, 0)
+	if len(messageIDs) == 0 {
+		return reactions, nil
+	}
+	in, args := sqlitePlaceholders(messageIDs)
+	rows, err := s.db.QueryContext(ctx, `SELECT message_id, account_id, emoji, created_at FROM message_reactions
+		WHERE message_id IN (`+in+`)
+		ORDER BY created_at, message_id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list reactions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			r         Reaction
+			createdAt string
+		)
+		if err := rows.Scan(&r.MessageID, &r.UserID, &r.Emoji, &createdAt); err != nil {
+			return nil, fmt.Errorf("decode reactions: %w", err)
+		}
+		r.CreatedAt = parseSQLiteTime(createdAt)
+		reactions = append(reactions, r)
+	}
+	return reactions, rows.Err()
+}
+
+// nullTime stores a nil time as NULL.
+func nullTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return formatSQLiteTime(*t)
+}
+
+func (s *sqliteStore) PutSanction(ctx context.Context, sn *Sanction) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO room_sanctions (room_id, account_id, kind, reason, created_by, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (room_id, account_id, kind) DO UPDATE SET reason = excluded.reason,
+			created_by = excluded.created_by, created_at = excluded.created_at, expires_at = excluded.expires_at`,
+		sn.RoomID, sn.UserID, sn.Kind, sn.Reason, sn.CreatedBy, formatSQLiteTime(sn.CreatedAt), nullTime(sn.ExpiresAt))
+	if err != nil {
+		return fmt.Errorf("put %s: %w", sn.Kind, err)
+	}
+	return nil
+}
+
+func (s *sqliteStore) GetSanction(ctx context.Context, roomID, userID, kind string) (*Sanction, error) {
+	var (
+		sn        Sanction
+		createdAt string
+		expiresAt sql.NullString
+	)
+	err := s.db.QueryRowContext(ctx,
+		`SELECT room_id, account_id, kind, reason, created_by, created_at, expires_at FROM room_sanctions
+		WHERE room_id = ? AND account_id = ? AND kind = ?`, roomID, userID, kind).
+		Scan(&sn.RoomID, &sn.UserID, &sn.Kind, &sn.Reason, &sn.CreatedBy, &createdAt, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lookup %s: %w", kind, err)
+	}
+	sn.CreatedAt = parseSQLiteTime(createdAt)
+	sn.ExpiresAt = parseNullSQLiteTime(expiresAt)
+	return &sn, nil
+}
+
+func (s *sqliteStore) DeleteSanction(ctx context.Context, roomID, userID, kind string) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		`DELETE FROM room_sanctions WHERE room_id = ? AND account_id = ? AND kind = ?`, roomID, userID, kind)
+	if err != nil {
+		return false, fmt.Errorf("delete %s: %w", kind, err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func (s *sqliteStore) AddModerationEntry(ctx context.Context, e *ModerationEntry) (*ModerationEntry, error) {
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO moderation_log (room_id, action, target_id, actor_id, reason, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		e.RoomID, e.Action, e.TargetID, e.ActorID, e.Reason, nullTime(e.ExpiresAt), formatSQLiteTime(e.CreatedAt))
+	if err != nil {
+		return nil, fmt.Errorf("insert moderation entry: %w", err)
+	}
+	saved := *e
+	if saved.ID, err = res.LastInsertId(); err != nil {
+		return nil, fmt.Errorf("moderation entry id: %w", err)
+	}
+	return &saved, nil
+}
+
+func (s *sqliteStore) ListModerationLog(ctx context.Context, roomID string, beforeID int64, limit int) ([]ModerationEntry, error) {
+	query := `SELECT id, room_id, action, target_id, actor_id, reason, expires_at, created_at FROM moderation_log WHERE room_id = ?`
+	args := []interface{}{roomID}
+	if beforeID > 0 {
+		query += ` AND id < ?`
+		args = append(args, beforeID)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, limit+1)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list moderation log: %w", err)
+	}
+	defer rows.Close()
+
+	entries := make([]ModerationEntry, 0)
+	for rows.Next() {
+		var (
+			e         ModerationEntry
+			expiresAt sql.NullString
+			createdAt string
+		)
+		if err := rows.Scan(&e.ID, &e.RoomID, &e.Action, &e.TargetID, &e.ActorID, &e.Reason, &expiresAt, &createdAt); err != nil {
+			return nil, fmt.Errorf("decode moderation log: %w", err)
+		}
+		e.ExpiresAt = parseNullSQLiteTime(expiresAt)
+		e.CreatedAt = parseSQLiteTime(createdAt)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func (s *sqliteStore) GetProfiles(ctx context.Context, userIDs []string) ([]Profile, error) {
+	profiles := make([]Profile, 0, len(userIDs))
+	if len(userIDs) == 0 {
+		return profiles, nil
+	}
+	in, args := sqlitePlaceholders(userIDs)
+	rows, err := s.db.QueryContext(ctx, `SELECT id, user_name, avatar_url, bio FROM profiles WHERE id IN (`+in+`)`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("fetch profiles: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p Profile
+		if err := rows.Scan(&p.UserID, &p.UserName, &p.AvatarURL, &p.Bio); err != nil {
+			return nil, fmt.Errorf("decode profiles: %w", err)
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, rows.Err()
+}
+
+func (s *sqliteStore) EnsureProfile(ctx context.Context, p *Profile) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO profiles (id, user_name) VALUES (?, ?) ON CONFLICT (id) DO NOTHING`,
+		p.UserID, p.UserName)
+	if err != nil {
+		return fmt.Errorf("insert profile: %w", err)
+	}
+	return nil
+}
+
+func (s *sqliteStore) UpdateProfile(ctx context.Context, p *Profile) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO profiles (id, user_name, avatar_url, bio) VALUES (?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET user_name = excluded.user_name, avatar_url = excluded.avatar_url, bio = excluded.bio`,
+		p.UserID, p.UserName, p.AvatarURL, p.Bio)
+	if err != nil {
+		return fmt.Errorf("update profile: %w", err)
+	}
+	return nil
+}
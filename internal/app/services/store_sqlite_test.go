@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// schemaVersions returns the versions recorded in schema_migrations, in order.
+func schemaVersions(t *testing.T, s *sqliteStore) []int {
+	t.Helper()
+	rows, err := s.db.Query(`SELECT version FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		t.Fatalf("read schema_migrations: %v", err)
+	}
+	defer rows.Close()
+	var versions []int
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			t.Fatalf("scan version: %v", err)
+		}
+		versions = append(versions, v)
+	}
+	return versions
+}
+
+func TestSQLiteMigrationsApplyInOrder(t *testing.T) {
+	all := sqliteMigrations
+	t.Cleanup(func() { sqliteMigrations = all })
+
+	want := make([]int, len(all))
+	for i := range want {
+		want[i] = i + 1
+	}
+
+	// Each case opens a database last migrated by an older build that shipped only
+	// the first `from` migrations, then upgrades it with the full list.
+	for _, from := range []int{0, 1, 4, len(all) - 1, len(all)} {
+		path := filepath.Join(t.TempDir(), "test.db")
+		if from > 0 {
+			sqliteMigrations = all[:from]
+			old, err := newSQLiteStore(path)
+			sqliteMigrations = all
+			if err != nil {
+				t.Fatalf("from %d: open at old version: %v", from, err)
+			}
+			old.db.Close()
+		}
+
+		s, err := newSQLiteStore(path)
+		if err != nil {
+			t.Fatalf("from %d: upgrade: %v", from, err)
+		}
+		if got := schemaVersions(t, s); !slices.Equal(got, want) {
+			t.Errorf("from %d: versions = %v, want %v", from, got, want)
+		}
+		// The newest migrations' tables must exist after the upgrade.
+		if _, err := s.db.Exec(`SELECT id, action FROM moderation_log LIMIT 1`); err != nil {
+			t.Errorf("from %d: moderation_log missing: %v", from, err)
+		}
+		// Reopening an up-to-date database applies nothing.
+		if err := s.migrate(context.Background()); err != nil {
+			t.Errorf("from %d: migrate again: %v", from, err)
+		}
+		if got := schemaVersions(t, s); !slices.Equal(got, want) {
+			t.Errorf("from %d: versions after reopen = %v, want %v", from, got, want)
+		}
+		s.db.Close()
+	}
+}
+
+func TestSQLiteTimeLayoutSortsChronologically(t *testing.T) {
+	base := time.Date(2026, 3, 1, 9, 59, 59, 0, time.UTC)
+	tests := []struct {
+		name           string
+		earlier, later time.Time
+	}{
+		{"whole second before fraction", base, base.Add(500 * time.Millisecond)},
+		{"short fraction before long", base.Add(500 * time.Millisecond), base.Add(523456 * time.Microsecond)},
+		{"fraction before next second", base.Add(999999 * time.Microsecond), base.Add(time.Second)},
+		{"one microsecond apart", base.Add(time.Microsecond), base.Add(2 * time.Microsecond)},
+		{"other zone converted to UTC", base.In(time.FixedZone("UTC+2", 2*3600)), base.Add(time.Millisecond)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := formatSQLiteTime(tt.earlier), formatSQLiteTime(tt.later)
+			if len(a) != len(b) {
+				t.Errorf("widths differ: %q vs %q", a, b)
+			}
+			if a >= b {
+				t.Errorf("%q does not sort before %q", a, b)
+			}
+			if got := parseSQLiteTime(a); !got.Equal(tt.earlier) {
+				t.Errorf("round trip = %v, want %v", got, tt.earlier)
+			}
+		})
+	}
+}
+
+func TestSQLiteListMessagesOrdersBySentAtThenID(t *testing.T) {
+	s, err := newSQLiteStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open sqlite store: %v", err)
+	}
+	defer s.db.Close()
+	ctx := context.Background()
+	roomID, m := seedMessages(t, s, 4)
+
+	// m[0] is the newest by sent_at despite its ID; m[1] and m[2] tie, so ID decides.
+	base := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	sentAt := map[int64]time.Time{
+		m[0]: base.Add(2 * time.Second),
+		m[1]: base.Add(time.Second),
+		m[2]: base.Add(time.Second),
+		m[3]: base,
+	}
+	for id, at := range sentAt {
+		if _, err := s.db.Exec(`UPDATE messages SET sent_at = ? WHERE id = ?`, formatSQLiteTime(at), id); err != nil {
+			t.Fatalf("set sent_at: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		q    MessageQuery
+		want []int64
+	}{
+		{"newest first", MessageQuery{Limit: 10}, []int64{m[0], m[2], m[1], m[3]}},
+		{"before_created_at", MessageQuery{BeforeCreatedAt: base.Add(time.Second), Limit: 10}, []int64{m[3]}},
+		{"after_id oldest first", MessageQuery{AfterID: m[0], Limit: 10}, []int64{m[3], m[1], m[2]}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := tt.q
+			q.RoomID = roomID
+			msgs, err := s.ListMessages(ctx, q)
+			if err != nil {
+				t.Fatalf("ListMessages: %v", err)
+			}
+			if got := messageIDs(msgs); !slices.Equal(got, tt.want) {
+				t.Errorf("ids = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
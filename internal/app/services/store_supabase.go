@@ -0,0 +1,1100 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// supabaseStore implements Store on top of the Supabase REST (PostgREST) API.
+type supabaseStore struct{}
+
+func newSupabaseStore() *supabaseStore {
+	loadEnv()
+	return &supabaseStore{}
+}
+
+// newRequest builds a REST request authenticated with the service API key.
+func (s *supabaseStore) newRequest(ctx context.Context, method, endpoint string, body io.Reader) *http.Request {
+	req, _ := http.NewRequestWithContext(ctx, method, endpoint, body)
+	req.Header.Set("Authorization", "Bearer "+supabaseAPIKey)
+	req.Header.Set("apikey", supabaseAPIKey)
+	if id := RequestID(ctx); id != "" {
+		req.Header.Set(RequestIDHeader, id)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req
+}
+
+// CreateRoom calls the create_room_with_owner function, which generates the code and inserts the owner membership.
+func (s *supabaseStore) CreateRoom(ctx context.Context, ownerID, title string, isPrivate bool) (*Room, error) {
+	// Call the PostgreSQL function with owner_id parameter
+	payload := map[string]interface{}{
+		"_owner_id":   ownerID,
+		"_title":      title,
+		"_is_private": isPrivate,
+	}
+
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req := s.newRequest(ctx, "POST", supabaseURL+"/rest/v1/rpc/create_room_with_owner", bytes.NewReader(payloadBytes))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create room: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("supabase create room failed (status %d): %s", resp.StatusCode, body)
+	}
+
+	// The function returns {"room_id": "...", "code": "..."}
+	var result map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode room response: %w", err)
+	}
+
+	return &Room{
+		ID:        result["room_id"],
+		Code:      result["code"],
+		OwnerID:   ownerID,
+		Title:     title,
+		IsPrivate: isPrivate,
+	}, nil
+}
+
+// supabaseRoomColumns selects the rooms columns decoded into Room.
+const supabaseRoomColumns = "id,code,owner_id,title,is_private,description,topic,created_at,archived_at"
+
+// ListRoomsByUser queries rooms with an inner join on room_members to ensure the user is a member.
+// The embedded room_members row carries the user's role.
+func (s *supabaseStore) ListRoomsByUser(ctx context.Context, userID string) ([]JoinedRoom, error) {
+	q := url.Values{}
+	q.Set("select", supabaseRoomColumns+",room_members!inner(role,account_id)")
+	q.Set("room_members.account_id", "eq."+userID)
+
+	endpoint := fmt.Sprintf("%s/rest/v1/rooms?%s", supabaseURL, q.Encode())
+	req := s.newRequest(ctx, "GET", endpoint, nil)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch rooms: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("fetch rooms failed (status %d): %s", resp.StatusCode, body)
+	}
+
+	// Response is rows from rooms table, each embedding the user's room_members row.
+	var rows []struct {
+		Room
+		Members []struct {
+			Role string `json:"role"`
+		} `json:"room_members"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&rows); err != nil {
+		return nil, fmt.Errorf("failed to decode rooms: %w", err)
+	}
+	rooms := make([]JoinedRoom, len(rows))
+	for i, row := range rows {
+		rooms[i] = JoinedRoom{Room: row.Room}
+		if len(row.Members) > 0 {
+			rooms[i].Role = row.Members[0].Role
+		}
+	}
+	return rooms, nil
+}
+
+// FindRoomByCode looks up a single room by its join code.
+func (s *supabaseStore) FindRoomByCode(ctx context.Context, code string) (*Room, error) {
+	q := url.Values{}
+	q.Set("code", "eq."+code)
+	q.Set("select", supabaseRoomColumns)
+	q.Set("limit", "1")
+
+	req := s.newRequest(ctx, "GET", fmt.Sprintf("%s/rest/v1/rooms?%s", supabaseURL, q.Encode()), nil)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("lookup room by code: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("lookup room failed (status %d): %s", resp.StatusCode, body)
+	}
+
+	var rooms []Room
+	if err := json.NewDecoder(resp.Body).Decode(&rooms); err != nil {
+		return nil, fmt.Errorf("decode room lookup: %w", err)
+	}
+	if len(rooms) == 0 {
+		return nil, ErrNotFound
+	}
+	return &rooms[0], nil
+}
+
+// AddMember inserts membership (idempotent upsert on PK room_id+account_id). Ignored
+// duplicates are not returned, so an empty representation means the member existed.
+func (s *supabaseStore) AddMember(ctx context.Context, roomID, userID, role string) (bool, error) {
+	payload := map[string]interface{}{
+		"room_id":    roomID,
+		"account_id": userID,
+		"role":       role,
+	}
+	body, _ := json.Marshal(payload)
+
+	req := s.newRequest(ctx, "POST", fmt.Sprintf("%s/rest/v1/room_members", supabaseURL), bytes.NewReader(body))
+	req.Header.Set("Prefer", "resolution=ignore-duplicates,return=representation")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("insert membership: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 201 {
+		b, _ := io.ReadAll(resp.Body)
+		return false, fmt.Errorf("insert membership failed (status %d): %s", resp.StatusCode, b)
+	}
+
+	var rows []Member
+	if err := json.NewDecoder(resp.Body).Decode(&rows); err != nil {
+		return false, fmt.Errorf("decode inserted membership: %w", err)
+	}
+	return len(rows) > 0, nil
+}
+
+// GetMemberRole reads the room_members row for the user.
+func (s *supabaseStore) GetMemberRole(ctx context.Context, roomID, userID string) (string, error) {
+	q := url.Values{}
+	q.Set("room_id", "eq."+roomID)
+	q.Set("account_id", "eq."+userID)
+	q.Set("select", "role")
+	q.Set("limit", "1")
+
+	req := s.newRequest(ctx, "GET", fmt.Sprintf("%s/rest/v1/room_members?%s", supabaseURL, q.Encode()), nil)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("lookup membership: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		b, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("lookup membership failed (status %d): %s", resp.StatusCode, b)
+	}
+
+	var rows []struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&rows); err != nil {
+		return "", fmt.Errorf("decode membership: %w", err)
+	}
+	if len(rows) == 0 {
+		return "", ErrNotFound
+	}
+	return rows[0].Role, nil
+}
+
+// RemoveMember deletes the room_members row, asking for it back to detect non-members.
+func (s *supabaseStore) RemoveMember(ctx context.Context, roomID, userID string) error {
+	q := url.Values{}
+	q.Set("room_id", "eq."+roomID)
+	q.Set("account_id", "eq."+userID)
+
+	req := s.newRequest(ctx, "DELETE", fmt.Sprintf("%s/rest/v1/room_members?%s", supabaseURL, q.Encode()), nil)
+	req.Header.Set("Prefer", "return=representation")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("delete membership: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("delete membership failed (status %d): %s", resp.StatusCode, b)
+	}
+
+	var rows []Member
+	if err := json.NewDecoder(resp.Body).Decode(&rows); err != nil {
+		return fmt.Errorf("decode deleted membership: %w", err)
+	}
+	if len(rows) == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListMembers returns room_members rows ordered by join time.
+func (s *supabaseStore) ListMembers(ctx context.Context, roomID string) ([]Member, error) {
+	q := url.Values{}
+	q.Set("room_id", "eq."+roomID)
+	q.Set("select", "room_id,account_id,role,joined_at")
+	q.Set("order", "joined_at.asc,account_id.asc")
+
+	req := s.newRequest(ctx, "GET", fmt.Sprintf("%s/rest/v1/room_members?%s", supabaseURL, q.Encode()), nil)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("list members: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		b, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("list members failed (status %d): %s", resp.StatusCode, b)
+	}
+
+	var members []Member
+	if err := json.NewDecoder(resp.Body).Decode(&members); err != nil {
+		return nil, fmt.Errorf("decode members: %w", err)
+	}
+	return members, nil
+}
+
+// patch applies a PostgREST PATCH to the rows matched by q and returns the changed rows.
+func (s *supabaseStore) patch(ctx context.Context, table string, q url.Values, fields map[string]interface{}) ([]json.RawMessage, error) {
+	body, err := json.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("marshal %s update: %w", table, err)
+	}
+
+	req := s.newRequest(ctx, "PATCH", fmt.Sprintf("%s/rest/v1/%s?%s", supabaseURL, table, q.Encode()), bytes.NewReader(body))
+	req.Header.Set("Prefer", "return=representation")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("update %s: %w", table, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		b, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("update %s failed (status %d): %s", table, resp.StatusCode, b)
+	}
+
+	var rows []json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&rows); err != nil {
+		return nil, fmt.Errorf("decode %s update: %w", table, err)
+	}
+	return rows, nil
+}
+
+// SetMemberRole updates the room_members row for the user.
+func (s *supabaseStore) SetMemberRole(ctx context.Context, roomID, userID, role string) error {
+	q := url.Values{}
+	q.Set("room_id", "eq."+roomID)
+	q.Set("account_id", "eq."+userID)
+	rows, err := s.patch(ctx, "room_members", q, map[string]interface{}{"role": role})
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// TransferOwnership promotes the new owner's membership, then points rooms.owner_id at them.
+func (s *supabaseStore) TransferOwnership(ctx context.Context, roomID, newOwnerID string) error {
+	q := url.Values{}
+	q.Set("room_id", "eq."+roomID)
+	q.Set("account_id", "eq."+newOwnerID)
+	rows, err := s.patch(ctx, "room_members", q, map[string]interface{}{"role": "owner"})
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return ErrNotFound
+	}
+
+	q = url.Values{}
+	q.Set("id", "eq."+roomID)
+	_, err = s.patch(ctx, "rooms", q, map[string]interface{}{"owner_id": newOwnerID})
+	return err
+}
+
+// ArchiveRoom sets rooms.archived_at if it is not already set.
+func (s *supabaseStore) ArchiveRoom(ctx context.Context, roomID string) error {
+	q := url.Values{}
+	q.Set("id", "eq."+roomID)
+	q.Set("archived_at", "is.null")
+	rows, err := s.patch(ctx, "rooms", q, map[string]interface{}{"archived_at": time.Now().UTC().Format(time.RFC3339Nano)})
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		// Either missing or already archived; only the former is an error.
+		if _, err := s.GetRoom(ctx, roomID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetRoom looks up a single room by id.
+func (s *supabaseStore) GetRoom(ctx context.Context, roomID string) (*Room, error) {
+	q := url.Values{}
+	q.Set("id", "eq."+roomID)
+	q.Set("select", supabaseRoomColumns)
+	q.Set("limit", "1")
+
+	req := s.newRequest(ctx, "GET", fmt.Sprintf("%s/rest/v1/rooms?%s", supabaseURL, q.Encode()), nil)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("lookup room: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("lookup room failed (status %d): %s", resp.StatusCode, body)
+	}
+
+	var rooms []Room
+	if err := json.NewDecoder(resp.Body).Decode(&rooms); err != nil {
+		return nil, fmt.Errorf("decode room lookup: %w", err)
+	}
+	if len(rooms) == 0 {
+		return nil, ErrNotFound
+	}
+	return &rooms[0], nil
+}
+
+// UpdateRoom patches the room's settings columns.
+func (s *supabaseStore) UpdateRoom(ctx context.Context, room *Room) error {
+	q := url.Values{}
+	q.Set("id", "eq."+room.ID)
+	fields := map[string]interface{}{
+		"title":       room.Title,
+		"is_private":  room.IsPrivate,
+		"description": room.Description,
+		"topic":       room.Topic,
+		"archived_at": nil,
+	}
+	if room.ArchivedAt != nil {
+		fields["archived_at"] = room.ArchivedAt.UTC().Format(time.RFC3339Nano)
+	}
+	rows, err := s.patch(ctx, "rooms", q, fields)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteRoom deletes the rooms row; the schema's ON DELETE CASCADE foreign keys remove
+// its memberships, messages, reactions, sanctions and moderation log.
+func (s *supabaseStore) DeleteRoom(ctx context.Context, roomID string) error {
+	q := url.Values{}
+	q.Set("id", "eq."+roomID)
+
+	req := s.newRequest(ctx, "DELETE", fmt.Sprintf("%s/rest/v1/rooms?%s", supabaseURL, q.Encode()), nil)
+	req.Header.Set("Prefer", "return=representation")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("delete room: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("delete room failed (status %d): %s", resp.StatusCode, b)
+	}
+
+	var rows []Room
+	if err := json.NewDecoder(resp.Body).Decode(&rows); err != nil {
+		return fmt.Errorf("decode deleted room: %w", err)
+	}
+	if len(rows) == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// CreateMessage inserts a new message into the messages table.
+func (s *supabaseStore) CreateMessage(ctx context.Context, draft *Message) (*Message, error) {
+	payload := map[string]interface{}{
+		"room_id":   draft.RoomID,
+		"sender_id": draft.SenderID,
+		"body":      draft.Body,
+	}
+	if draft.ReplyToID != 0 {
+		payload["reply_to_id"] = draft.ReplyToID
+	}
+	if draft.ThreadRootID != 0 {
+		payload["thread_root_id"] = draft.ThreadRootID
+	}
+	if draft.ClientMsgID != "" {
+		payload["client_msg_id"] = draft.ClientMsgID
+	}
+
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("marshal message payload: %w", err)
+	}
+
+	req := s.newRequest(ctx, "POST", supabaseURL+"/rest/v1/messages", bytes.NewReader(b))
+	req.Header.Set("Prefer", "return=representation")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("send message: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 201 { // 201 Created expected with return=representation
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("supabase message insert failed (status %d): %s", resp.StatusCode, bodyBytes)
+	}
+
+	var rows []Message
+	if err := json.NewDecoder(resp.Body).Decode(&rows); err != nil {
+		return nil, fmt.Errorf("decode message response: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("message insert returned no rows")
+	}
+	return &rows[0], nil
+}
+
+// ListMessages pages backwards through a room with optional before-id pagination.
+func (s *supabaseStore) ListMessages(ctx context.Context, mq MessageQuery) ([]Message, error) {
+	q := url.Values{}
+	q.Set("room_id", "eq."+mq.RoomID)
+	q.Set("select", supabaseMessageColumns)
+	q.Set("order", "sent_at.desc,id.desc")
+	q.Set("limit", fmt.Sprintf("%d", mq.Limit+1))
+	if mq.BeforeID != "" {
+		q.Set("id", "lt."+mq.BeforeID)
+	}
+	if mq.AfterID != 0 {
+		q.Set("id", fmt.Sprintf("gt.%d", mq.AfterID))
+		q.Set("order", "sent_at.asc,id.asc")
+	}
+	if !mq.BeforeCreatedAt.IsZero() {
+		q.Set("sent_at", "lt."+mq.BeforeCreatedAt.UTC().Format(time.RFC3339Nano))
+	}
+	if !mq.IncludeSystem {
+		q.Set("type", "eq.text")
+	}
+	if mq.ThreadRootID != 0 {
+		q.Set("thread_root_id", fmt.Sprintf("eq.%d", mq.ThreadRootID))
+	} else {
+		q.Set("thread_root_id", "is.null")
+	}
+
+	endpoint := fmt.Sprintf("%s/rest/v1/messages?%s", supabaseURL, q.Encode())
+	req := s.newRequest(ctx, "GET", endpoint, nil)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch messages: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("fetch messages failed (status %d): %s", resp.StatusCode, bodyBytes)
+	}
+
+	var rows []Message
+	if err := json.NewDecoder(resp.Body).Decode(&rows); err != nil {
+		return nil, fmt.Errorf("decode messages: %w", err)
+	}
+	return rows, nil
+}
+
+// supabaseMessageColumns is the select list for message rows.
+const supabaseMessageColumns = "id,room_id,sender_id,body,type,sent_at,edited_at,deleted_at,reply_to_id,thread_root_id,client_msg_id"
+
+// idList renders ids for a PostgREST in.(...) filter.
+func idList(ids []int64) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.FormatInt(id, 10)
+	}
+	return "in.(" + strings.Join(parts, ",") + ")"
+}
+
+// getMessages runs a messages query and decodes the rows.
+func (s *supabaseStore) getMessages(ctx context.Context, q url.Values) ([]Message, error) {
+	req := s.newRequest(ctx, "GET", fmt.Sprintf("%s/rest/v1/messages?%s", supabaseURL, q.Encode()), nil)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("lookup messages: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		b, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("lookup messages failed (status %d): %s", resp.StatusCode, b)
+	}
+
+	var rows []Message
+	if err := json.NewDecoder(resp.Body).Decode(&rows); err != nil {
+		return nil, fmt.Errorf("decode messages: %w", err)
+	}
+	return rows, nil
+}
+
+// FindMessageByClientID finds the sender's first message with clientMsgID since the given time.
+func (s *supabaseStore) FindMessageByClientID(ctx context.Context, senderID, clientMsgID string, since time.Time) (*Message, error) {
+	q := url.Values{}
+	q.Set("sender_id", "eq."+senderID)
+	q.Set("client_msg_id", "eq."+clientMsgID)
+	q.Set("sent_at", "gte."+since.UTC().Format(time.RFC3339Nano))
+	q.Set("select", supabaseMessageColumns)
+	q.Set("order", "id.asc")
+	q.Set("limit", "1")
+	rows, err := s.getMessages(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, ErrNotFound
+	}
+	return &rows[0], nil
+}
+
+// GetMessages looks up several messages by id in one request.
+func (s *supabaseStore) GetMessages(ctx context.Context, ids []int64) ([]Message, error) {
+	if len(ids) == 0 {
+		return []Message{}, nil
+	}
+	q := url.Values{}
+	q.Set("id", idList(ids))
+	q.Set("select", supabaseMessageColumns)
+	return s.getMessages(ctx, q)
+}
+
+// CountReplies fetches the thread_root_id of every live reply and counts them per root.
+func (s *supabaseStore) CountReplies(ctx context.Context, rootIDs []int64) (map[int64]int, error) {
+	counts := make(map[int64]int)
+	if len(rootIDs) == 0 {
+		return counts, nil
+	}
+	q := url.Values{}
+	q.Set("thread_root_id", idList(rootIDs))
+	q.Set("deleted_at", "is.null")
+	q.Set("select", "thread_root_id")
+	rows, err := s.getMessages(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		counts[r.ThreadRootID]++
+	}
+	return counts, nil
+}
+
+// GetMessage looks up a single message by id.
+func (s *supabaseStore) GetMessage(ctx context.Context, id int64) (*Message, error) {
+	q := url.Values{}
+	q.Set("id", fmt.Sprintf("eq.%d", id))
+	q.Set("select", supabaseMessageColumns)
+	q.Set("limit", "1")
+
+	req := s.newRequest(ctx, "GET", fmt.Sprintf("%s/rest/v1/messages?%s", supabaseURL, q.Encode()), nil)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("lookup message: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		b, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("lookup message failed (status %d): %s", resp.StatusCode, b)
+	}
+
+	var rows []Message
+	if err := json.NewDecoder(resp.Body).Decode(&rows); err != nil {
+		return nil, fmt.Errorf("decode message: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, ErrNotFound
+	}
+	return &rows[0], nil
+}
+
+// updateMessage patches one message and returns the updated row.
+func (s *supabaseStore) updateMessage(ctx context.Context, q url.Values, fields map[string]interface{}) (*Message, error) {
+	rows, err := s.patch(ctx, "messages", q, fields)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, ErrNotFound
+	}
+	var msg Message
+	if err := json.Unmarshal(rows[0], &msg); err != nil {
+		return nil, fmt.Errorf("decode message: %w", err)
+	}
+	return &msg, nil
+}
+
+// EditMessage replaces the body and stamps edited_at.
+func (s *supabaseStore) EditMessage(ctx context.Context, id int64, body string) (*Message, error) {
+	q := url.Values{}
+	q.Set("id", fmt.Sprintf("eq.%d", id))
+	return s.updateMessage(ctx, q, map[string]interface{}{
+		"body":      body,
+		"edited_at": time.Now().UTC().Format(time.RFC3339Nano),
+	})
+}
+
+// DeleteMessage clears the body and stamps deleted_at, keeping the first deletion time.
+func (s *supabaseStore) DeleteMessage(ctx context.Context, id int64) (*Message, error) {
+	msg, err := s.GetMessage(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if msg.DeletedAt != nil {
+		return msg, nil
+	}
+	q := url.Values{}
+	q.Set("id", fmt.Sprintf("eq.%d", id))
+	return s.updateMessage(ctx, q, map[string]interface{}{
+		"body":       "",
+		"deleted_at": time.Now().UTC().Format(time.RFC3339Nano),
+	})
+}
+
+// AddReaction inserts into message_reactions, ignoring duplicates; the returned
+// representation is empty when the reaction already existed.
+func (s *supabaseStore) AddReaction(ctx context.Context, messageID int64, userID, emoji string) (bool, error) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"message_id": messageID,
+		"account_id": userID,
+		"emoji":      emoji,
+	})
+
+	req := s.newRequest(ctx, "POST", supabaseURL+"/rest/v1/message_reactions", bytes.NewReader(body))
+	req.Header.Set("Prefer", "resolution=ignore-duplicates,return=representation")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("add reaction: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 201 {
+		b, _ := io.ReadAll(resp.Body)
+		return false, fmt.Errorf("add reaction failed (status %d): %s", resp.StatusCode, b)
+	}
+
+	var rows []Reaction
+	if err := json.NewDecoder(resp.Body).Decode(&rows); err != nil {
+		return false, fmt.Errorf("decode reaction: %w", err)
+	}
+	return len(rows) > 0, nil
+}
+
+// RemoveReaction deletes the user's emoji from a message.
+func (s *supabaseStore) RemoveReaction(ctx context.Context, messageID int64, userID, emoji string) (bool, error) {
+	q := url.Values{}
+	q.Set("message_id", fmt.Sprintf("eq.%d", messageID))
+	q.Set("account_id", "eq."+userID)
+	q.Set("emoji", "eq."+emoji)
+
+	req := s.newRequest(ctx, "DELETE", fmt.Sprintf("%s/rest/v1/message_reactions?%s", supabaseURL, q.Encode()), nil)
+	req.Header.Set("Prefer", "return=representation")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("remove reaction: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		b, _ := io.ReadAll(resp.Body)
+		return false, fmt.Errorf("remove reaction failed (status %d): %s", resp.StatusCode, b)
+	}
+
+	var rows []Reaction
+	if err := json.NewDecoder(resp.Body).Decode(&rows); err != nil {
+		return false, fmt.Errorf("decode removed reaction: %w", err)
+	}
+	return len(rows) > 0, nil
+}
+
+// ListReactions fetches reactions for a page of messages in one request.
+func (s *supabaseStore) ListReactions(ctx context.Context, messageIDs []int64) ([]Reaction, error) {
+	if len(messageIDs) == 0 {
+		return []Reaction{}, nil
+	}
+	q := url.Values{}
+	q.Set("message_id", idList(messageIDs))
+	q.Set("select", "message_id,account_id,emoji,created_at")
+	q.Set("order", "created_at.asc,message_id.asc")
+
+	req := s.newRequest(ctx, "GET", fmt.Sprintf("%s/rest/v1/message_reactions?%s", supabaseURL, q.Encode()), nil)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("list reactions: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		b, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("list reactions failed (status %d): %s", resp.StatusCode, b)
+	}
+
+	var reactions []Reaction
+	if err := json.NewDecoder(resp.Body).Decode(&reactions); err != nil {
+		return nil, fmt.Errorf("decode reactions: %w", err)
+	}
+	return reactions, nil
+}
+
+// PutSanction upserts the room_sanctions row for the user and kind.
+func (s *supabaseStore) PutSanction(ctx context.Context, sn *Sanction) error {
+	body, _ := json.Marshal(sn)
+
+	req := s.newRequest(ctx, "POST", supabaseURL+"/rest/v1/room_sanctions?on_conflict=room_id,account_id,kind", bytes.NewReader(body))
+	req.Header.Set("Prefer", "resolution=merge-duplicates")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("put %s: %w", sn.Kind, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 201 && resp.StatusCode != 204 && resp.StatusCode != 200 {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("put %s failed (status %d): %s", sn.Kind, resp.StatusCode, b)
+	}
+	return nil
+}
+
+// GetSanction reads the room_sanctions row for the user and kind.
+func (s *supabaseStore) GetSanction(ctx context.Context, roomID, userID, kind string) (*Sanction, error) {
+	q := url.Values{}
+	q.Set("room_id", "eq."+roomID)
+	q.Set("account_id", "eq."+userID)
+	q.Set("kind", "eq."+kind)
+	q.Set("limit", "1")
+
+	req := s.newRequest(ctx, "GET", fmt.Sprintf("%s/rest/v1/room_sanctions?%s", supabaseURL, q.Encode()), nil)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("lookup %s: %w", kind, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		b, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("lookup %s failed (status %d): %s", kind, resp.StatusCode, b)
+	}
+
+	var rows []Sanction
+	if err := json.NewDecoder(resp.Body).Decode(&rows); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", kind, err)
+	}
+	if len(rows) == 0 {
+		return nil, ErrNotFound
+	}
+	return &rows[0], nil
+}
+
+// DeleteSanction deletes the room_sanctions row, asking for it back to report whether one existed.
+func (s *supabaseStore) DeleteSanction(ctx context.Context, roomID, userID, kind string) (bool, error) {
+	q := url.Values{}
+	q.Set("room_id", "eq."+roomID)
+	q.Set("account_id", "eq."+userID)
+	q.Set("kind", "eq."+kind)
+
+	req := s.newRequest(ctx, "DELETE", fmt.Sprintf("%s/rest/v1/room_sanctions?%s", supabaseURL, q.Encode()), nil)
+	req.Header.Set("Prefer", "return=representation")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("delete %s: %w", kind, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		b, _ := io.ReadAll(resp.Body)
+		return false, fmt.Errorf("delete %s failed (status %d): %s", kind, resp.StatusCode, b)
+	}
+
+	var rows []Sanction
+	if err := json.NewDecoder(resp.Body).Decode(&rows); err != nil {
+		return false, fmt.Errorf("decode deleted %s: %w", kind, err)
+	}
+	return len(rows) > 0, nil
+}
+
+// AddModerationEntry inserts a moderation_log row; the id comes from the table's identity column.
+func (s *supabaseStore) AddModerationEntry(ctx context.Context, e *ModerationEntry) (*ModerationEntry, error) {
+	payload := map[string]interface{}{
+		"room_id":    e.RoomID,
+		"action":     e.Action,
+		"target_id":  e.TargetID,
+		"actor_id":   e.ActorID,
+		"reason":     e.Reason,
+		"expires_at": e.ExpiresAt,
+		"created_at": e.CreatedAt,
+	}
+	body, _ := json.Marshal(payload)
+
+	req := s.newRequest(ctx, "POST", supabaseURL+"/rest/v1/moderation_log", bytes.NewReader(body))
+	req.Header.Set("Prefer", "return=representation")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("insert moderation entry: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 201 {
+		b, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("insert moderation entry failed (status %d): %s", resp.StatusCode, b)
+	}
+
+	var rows []ModerationEntry
+	if err := json.NewDecoder(resp.Body).Decode(&rows); err != nil {
+		return nil, fmt.Errorf("decode moderation entry: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("moderation entry insert returned no rows")
+	}
+	return &rows[0], nil
+}
+
+// ListModerationLog pages backwards through a room's moderation_log by id.
+func (s *supabaseStore) ListModerationLog(ctx context.Context, roomID string, beforeID int64, limit int) ([]ModerationEntry, error) {
+	q := url.Values{}
+	q.Set("room_id", "eq."+roomID)
+	if beforeID > 0 {
+		q.Set("id", fmt.Sprintf("lt.%d", beforeID))
+	}
+	q.Set("order", "id.desc")
+	q.Set("limit", strconv.Itoa(limit+1))
+
+	req := s.newRequest(ctx, "GET", fmt.Sprintf("%s/rest/v1/moderation_log?%s", supabaseURL, q.Encode()), nil)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("list moderation log: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		b, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("list moderation log failed (status %d): %s", resp.StatusCode, b)
+	}
+
+	var entries []ModerationEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("decode moderation log: %w", err)
+	}
+	return entries, nil
+}
+
+// GetProfiles reads the public profiles table in one request. Users with no row yet
+// (not logged in since the table was added) are looked up on the auth admin endpoint
+// and given one.
+func (s *supabaseStore) GetProfiles(ctx context.Context, userIDs []string) ([]Profile, error) {
+	profiles := make([]Profile, 0, len(userIDs))
+	if len(userIDs) == 0 {
+		return profiles, nil
+	}
+	q := url.Values{}
+	q.Set("id", "in.("+strings.Join(userIDs, ",")+")")
+	q.Set("select", "id,user_name,avatar_url,bio")
+	req := s.newRequest(ctx, "GET", fmt.Sprintf("%s/rest/v1/profiles?%s", supabaseURL, q.Encode()), nil)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch profiles: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		b, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("fetch profiles failed (status %d): %s", resp.StatusCode, b)
+	}
+	var rows []struct {
+		ID        string  `json:"id"`
+		UserName  string  `json:"user_name"`
+		AvatarURL *string `json:"avatar_url"`
+		Bio       *string `json:"bio"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&rows); err != nil {
+		return nil, fmt.Errorf("decode profiles: %w", err)
+	}
+
+	found := make(map[string]bool, len(rows))
+	for _, r := range rows {
+		found[r.ID] = true
+		p := Profile{UserID: r.ID, UserName: r.UserName}
+		if r.AvatarURL != nil {
+			p.AvatarURL = *r.AvatarURL
+		}
+		if r.Bio != nil {
+			p.Bio = *r.Bio
+		}
+		profiles = append(profiles, p)
+	}
+	missing := make([]string, 0)
+	for _, id := range userIDs {
+		if !found[id] {
+			missing = append(missing, id)
+		}
+	}
+	fallback, err := s.getAuthProfiles(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	return append(profiles, fallback...), nil
+}
+
+// authLookupConcurrency caps the auth admin requests getAuthProfiles runs at once.
+const authLookupConcurrency = 8
+
+// getAuthProfiles looks users up on the auth admin endpoint, a few at a time, and
+// backfills the profiles table with what it finds so the next batch reads them in
+// one request. Users unknown to auth are left out.
+func (s *supabaseStore) getAuthProfiles(ctx context.Context, userIDs []string) ([]Profile, error) {
+	results := make([]*Profile, len(userIDs))
+	errs := make([]error, len(userIDs))
+	sem := make(chan struct{}, authLookupConcurrency)
+	var wg sync.WaitGroup
+	for i, id := range userIDs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i], errs[i] = s.getAuthProfile(ctx, id)
+		}()
+	}
+	wg.Wait()
+
+	profiles := make([]Profile, 0, len(userIDs))
+	rows := make([]map[string]interface{}, 0, len(userIDs))
+	for i, p := range results {
+		if errors.Is(errs[i], ErrNotFound) {
+			continue
+		}
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		profiles = append(profiles, *p)
+		rows = append(rows, map[string]interface{}{"id": p.UserID, "user_name": p.UserName})
+	}
+	if len(rows) > 0 {
+		// A failed backfill only costs another fallback lookup later.
+		if err := s.writeProfile(ctx, rows, "resolution=ignore-duplicates"); err != nil {
+			Logf(ctx, "backfill %d profiles: %v", len(rows), err)
+		}
+	}
+	return profiles, nil
+}
+
+// getAuthProfile gets user_name from the auth admin endpoint using the service key.
+func (s *supabaseStore) getAuthProfile(ctx context.Context, userID string) (*Profile, error) {
+	if supabaseAPIKey == "" || supabaseURL == "" {
+		return nil, fmt.Errorf("supabase config missing")
+	}
+	endpoint := fmt.Sprintf("%s/auth/v1/admin/users/%s", supabaseURL, userID)
+	req := s.newRequest(ctx, "GET", endpoint, nil)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 404 {
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != 200 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("fetch user failed status %d: %s", resp.StatusCode, bodyBytes)
+	}
+
+	var user struct {
+		UserMetadata map[string]interface{} `json:"user_metadata"`
+		RawMeta      map[string]interface{} `json:"raw_user_meta_data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return nil, err
+	}
+
+	p := &Profile{UserID: userID}
+	if name, ok := user.UserMetadata["user_name"].(string); ok {
+		p.UserName = name
+	} else if name, ok := user.RawMeta["user_name"].(string); ok {
+		p.UserName = name
+	}
+	return p, nil
+}
+
+// EnsureProfile copies the login profile into the public profiles table (so
+// GetProfiles can batch it) unless the user already has a row.
+func (s *supabaseStore) EnsureProfile(ctx context.Context, p *Profile) error {
+	return s.writeProfile(ctx, map[string]interface{}{"id": p.UserID, "user_name": p.UserName}, "resolution=ignore-duplicates")
+}
+
+// UpdateProfile upserts the user's editable profile fields.
+func (s *supabaseStore) UpdateProfile(ctx context.Context, p *Profile) error {
+	return s.writeProfile(ctx, map[string]interface{}{
+		"id":         p.UserID,
+		"user_name":  p.UserName,
+		"avatar_url": p.AvatarURL,
+		"bio":        p.Bio,
+	}, "resolution=merge-duplicates")
+}
+
+// writeProfile inserts one profiles row, or a slice of them, resolving existing rows
+// as prefer says.
+func (s *supabaseStore) writeProfile(ctx context.Context, rows interface{}, prefer string) error {
+	body, _ := json.Marshal(rows)
+
+	req := s.newRequest(ctx, "POST", fmt.Sprintf("%s/rest/v1/profiles?on_conflict=id", supabaseURL), bytes.NewReader(body))
+	req.Header.Set("Prefer", prefer)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("write profile: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 201 && resp.StatusCode != 204 && resp.StatusCode != 200 {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("write profile failed (status %d): %s", resp.StatusCode, b)
+	}
+	return nil
+}
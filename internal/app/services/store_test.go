@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+// testStores returns a fresh store of each in-process backend, keyed by name.
+func testStores(t *testing.T) map[string]Store {
+	t.Helper()
+	sqlite, err := newSQLiteStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open sqlite store: %v", err)
+	}
+	t.Cleanup(func() { sqlite.db.Close() })
+	return map[string]Store{
+		"memory": newMemoryStore(),
+		"sqlite": sqlite,
+	}
+}
+
+// seedMessages creates a room with n main-timeline messages and returns the room ID
+// and the message IDs in send order.
+func seedMessages(t *testing.T, st Store, n int) (string, []int64) {
+	t.Helper()
+	ctx := context.Background()
+	room, err := st.CreateRoom(ctx, "owner", "room", false)
+	if err != nil {
+		t.Fatalf("create room: %v", err)
+	}
+	ids := make([]int64, n)
+	for i := range ids {
+		msg, err := st.CreateMessage(ctx, &Message{RoomID: room.ID, SenderID: "owner", Body: "hello"})
+		if err != nil {
+			t.Fatalf("create message: %v", err)
+		}
+		ids[i] = msg.ID
+	}
+	return room.ID, ids
+}
+
+func messageIDs(msgs []Message) []int64 {
+	ids := make([]int64, len(msgs))
+	for i, m := range msgs {
+		ids[i] = m.ID
+	}
+	return ids
+}
+
+func TestStoreListMessagesPaging(t *testing.T) {
+	for name, st := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			roomID, m := seedMessages(t, st, 5)
+			reply, err := st.CreateMessage(ctx, &Message{RoomID: roomID, SenderID: "owner", Body: "reply", ThreadRootID: m[0]})
+			if err != nil {
+				t.Fatalf("create reply: %v", err)
+			}
+			otherRoom, _ := seedMessages(t, st, 1)
+
+			// Stores return up to Limit+1 rows so callers can tell whether more exist.
+			tests := []struct {
+				name string
+				q    MessageQuery
+				want []int64
+			}{
+				{"latest page newest first", MessageQuery{Limit: 2}, []int64{m[4], m[3], m[2]}},
+				{"before_id pages back", MessageQuery{BeforeID: strconv.FormatInt(m[3], 10), Limit: 2}, []int64{m[2], m[1], m[0]}},
+				{"before_id last page", MessageQuery{BeforeID: strconv.FormatInt(m[1], 10), Limit: 2}, []int64{m[0]}},
+				{"after_id pages forward oldest first", MessageQuery{AfterID: m[1], Limit: 2}, []int64{m[2], m[3], m[4]}},
+				{"after_id past the end", MessageQuery{AfterID: m[4], Limit: 2}, []int64{}},
+				{"thread replies only", MessageQuery{ThreadRootID: m[0], Limit: 10}, []int64{reply.ID}},
+				{"zero limit probes one row", MessageQuery{BeforeID: strconv.FormatInt(m[4], 10), Limit: 0}, []int64{m[3]}},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					q := tt.q
+					q.RoomID = roomID
+					msgs, err := st.ListMessages(ctx, q)
+					if err != nil {
+						t.Fatalf("ListMessages: %v", err)
+					}
+					if got := messageIDs(msgs); !slices.Equal(got, tt.want) {
+						t.Errorf("ids = %v, want %v", got, tt.want)
+					}
+				})
+			}
+
+			msgs, err := st.ListMessages(ctx, MessageQuery{RoomID: otherRoom, Limit: 10})
+			if err != nil {
+				t.Fatalf("ListMessages other room: %v", err)
+			}
+			if len(msgs) != 1 {
+				t.Errorf("other room has %d messages, want 1", len(msgs))
+			}
+		})
+	}
+}
+
+func TestStoreListMessagesRejectsBadCursor(t *testing.T) {
+	for name, st := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			roomID, _ := seedMessages(t, st, 1)
+			if _, err := st.ListMessages(context.Background(), MessageQuery{RoomID: roomID, BeforeID: "abc"}); err == nil {
+				t.Error("ListMessages with a non-numeric before_id succeeded")
+			}
+		})
+	}
+}
@@ -1,12 +1,16 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"strings"
 	"sync"
+	"time"
 )
 
 var (
@@ -26,6 +30,7 @@ type SupabaseUser struct {
 	ID           string                 `json:"id"`
 	Email        string                 `json:"email"`
 	UserMetadata map[string]interface{} `json:"user_metadata"`
+	ExpiresAt    time.Time              `json:"-"` // exp claim of the verified token
 }
 
 // GetUserName extracts username from user_metadata, falls back to empty string.
@@ -39,13 +44,70 @@ func (u *SupabaseUser) GetUserName() string {
 	return ""
 }
 
-// VerifyToken validates JWT with Supabase and returns user info.
-func VerifyToken(token string) (*SupabaseUser, error) {
-	loadEnv()
+var (
+	jwtVerifier  *JWTVerifier
+	restFallback bool
+	verifierOnce sync.Once
+)
+
+// loadVerifier builds the process-wide JWT verifier from the environment:
+// SUPABASE_JWT_SECRET (HS256) and/or SUPABASE_JWKS_URL (RS256/ES256, refreshed every
+// JWKS_REFRESH_INTERVAL), checked against JWT_AUDIENCE and JWT_ISSUER.
+// AUTH_REST_FALLBACK controls whether /auth/v1/user is used when no local key can check a token.
+func loadVerifier() {
+	verifierOnce.Do(func() {
+		loadEnv()
+		issuer := ""
+		if supabaseURL != "" {
+			issuer = strings.TrimRight(supabaseURL, "/") + "/auth/v1"
+		}
+		jwtVerifier = NewJWTVerifier(JWTVerifierConfig{
+			Secret:          []byte(os.Getenv("SUPABASE_JWT_SECRET")),
+			JWKSURL:         os.Getenv("SUPABASE_JWKS_URL"),
+			APIKey:          supabaseAPIKey,
+			RefreshInterval: envDuration("JWKS_REFRESH_INTERVAL", time.Hour),
+			Audience:        envString("JWT_AUDIENCE", "authenticated"),
+			Issuer:          envString("JWT_ISSUER", issuer),
+			Leeway:          envDuration("JWT_LEEWAY", 30*time.Second),
+		})
+		restFallback = envBool("AUTH_REST_FALLBACK", true)
+	})
+}
+
+// VerifyToken validates the JWT locally when a secret/JWKS is configured, and
+// otherwise (or when no local key matches and fallback is enabled) with Supabase Auth.
+func VerifyToken(ctx context.Context, token string) (*SupabaseUser, error) {
+	loadVerifier()
+
+	if jwtVerifier.Enabled() {
+		claims, err := jwtVerifier.Verify(token)
+		if err == nil {
+			return &SupabaseUser{
+				ID:           claims.UserID,
+				Email:        claims.Email,
+				UserMetadata: map[string]interface{}{"user_name": claims.UserName},
+				ExpiresAt:    claims.ExpiresAt,
+			}, nil
+		}
+		if !errors.Is(err, ErrNoVerificationKey) || !restFallback {
+			return nil, err
+		}
+		Logf(ctx, "local token verification unavailable, falling back to REST: %v", err)
+	} else if !restFallback {
+		return nil, fmt.Errorf("%w: local verification not configured and REST fallback disabled", ErrNoVerificationKey)
+	}
+
+	return verifyTokenREST(ctx, token)
+}
 
-	req, _ := http.NewRequest("GET", supabaseURL+"/auth/v1/user", nil)
+// verifyTokenREST validates JWT with Supabase and returns user info.
+func verifyTokenREST(ctx context.Context, token string) (*SupabaseUser, error) {
+	req, _ := http.NewRequestWithContext(ctx, "GET", supabaseURL+"/auth/v1/user", nil)
 	req.Header.Set("Authorization", "Bearer "+token)
 	req.Header.Set("apikey", supabaseAPIKey)
+	if id := RequestID(ctx); id != "" {
+		req.Header.Set(RequestIDHeader, id)
+	}
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
@@ -62,5 +124,26 @@ func VerifyToken(token string) (*SupabaseUser, error) {
 	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
 		return nil, err
 	}
+	// Supabase accepted the token, so its exp claim can be trusted without re-checking the signature.
+	user.ExpiresAt = unverifiedExpiry(token)
 	return &user, nil
 }
+
+// unverifiedExpiry reads the exp claim without checking the signature; zero if absent.
+func unverifiedExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	var claims struct {
+		Exp *json.Number `json:"exp"`
+	}
+	if err := decodeSegment(parts[1], &claims); err != nil || claims.Exp == nil {
+		return time.Time{}
+	}
+	exp, err := numericDate(*claims.Exp)
+	if err != nil {
+		return time.Time{}
+	}
+	return exp
+}
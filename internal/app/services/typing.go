@@ -0,0 +1,151 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"github.com/DarthPestilane/easytcp"
+)
+
+// TypingRoute is the push route for typing indicators.
+const TypingRoute = 304
+
+// TypingEvent is the data of a route 304 push. While Typing is true, clients should
+// show the indicator for at most ExpiresInMs unless another start arrives.
+type TypingEvent struct {
+	RoomID      string `json:"room_id"`
+	UserID      string `json:"user_id"`
+	UserName    string `json:"user_name,omitempty"`
+	Typing      bool   `json:"typing"`
+	ExpiresInMs int64  `json:"expires_in_ms,omitempty"`
+}
+
+// typingState is one user typing in one room.
+type typingState struct {
+	roomID   string
+	userID   string
+	userName string
+	sess     easytcp.Session // the connection that last signalled; its own echo is skipped
+	lastSent time.Time
+	timer    *time.Timer
+}
+
+var (
+	typingStates = make(map[string]*typingState) // room_id|user_id -> state
+	typingMu     sync.Mutex
+
+	typingThrottle time.Duration
+	typingTimeout  time.Duration
+	typingEnvOnce  sync.Once
+)
+
+// loadTypingEnv reads TYPING_THROTTLE (default 3s: repeated starts within it are not
+// re-broadcast) and TYPING_TIMEOUT (default 6s: typing stops if not renewed).
+func loadTypingEnv() {
+	typingEnvOnce.Do(func() {
+		typingThrottle = envDuration("TYPING_THROTTLE", 3*time.Second)
+		typingTimeout = envDuration("TYPING_TIMEOUT", 6*time.Second)
+		if typingTimeout <= 0 {
+			typingTimeout = 6 * time.Second
+		}
+	})
+}
+
+func typingKey(roomID, userID string) string {
+	return roomID + "|" + userID
+}
+
+// SetTyping records a typing start or stop from sess and fans it out to the room's
+// other subscribers. Starts are throttled and expire after TYPING_TIMEOUT without renewal.
+func SetTyping(sess easytcp.Session, roomID, userID, userName string, typing bool) {
+	loadTypingEnv()
+	if !typing {
+		ClearTyping(roomID, userID)
+		return
+	}
+
+	key := typingKey(roomID, userID)
+	now := time.Now()
+
+	typingMu.Lock()
+	st, ok := typingStates[key]
+	if !ok {
+		st = &typingState{roomID: roomID, userID: userID}
+		typingStates[key] = st
+	} else {
+		st.timer.Stop()
+	}
+	st.userName = userName
+	st.sess = sess
+	st.timer = time.AfterFunc(typingTimeout, func() { expireTyping(key, st) })
+	announce := !ok || now.Sub(st.lastSent) >= typingThrottle
+	if announce {
+		st.lastSent = now
+	}
+	typingMu.Unlock()
+
+	if announce {
+		broadcastTyping(st, true)
+	}
+}
+
+// ClearTyping stops the user's indicator in the room (explicit stop, message sent, left the room).
+func ClearTyping(roomID, userID string) {
+	typingMu.Lock()
+	st, ok := typingStates[typingKey(roomID, userID)]
+	if ok {
+		st.timer.Stop()
+		delete(typingStates, typingKey(roomID, userID))
+	}
+	typingMu.Unlock()
+
+	if ok {
+		broadcastTyping(st, false)
+	}
+}
+
+// ClearTypingForSession stops every indicator last signalled from a closed connection.
+func ClearTypingForSession(sess easytcp.Session) {
+	var stopped []*typingState
+	typingMu.Lock()
+	for key, st := range typingStates {
+		if st.sess.ID() == sess.ID() {
+			st.timer.Stop()
+			delete(typingStates, key)
+			stopped = append(stopped, st)
+		}
+	}
+	typingMu.Unlock()
+
+	for _, st := range stopped {
+		broadcastTyping(st, false)
+	}
+}
+
+// expireTyping ends an indicator that was not renewed in time.
+func expireTyping(key string, st *typingState) {
+	typingMu.Lock()
+	if typingStates[key] != st {
+		typingMu.Unlock()
+		return
+	}
+	delete(typingStates, key)
+	typingMu.Unlock()
+
+	broadcastTyping(st, false)
+}
+
+func broadcastTyping(st *typingState, typing bool) {
+	ev := TypingEvent{
+		RoomID:   st.roomID,
+		UserID:   st.userID,
+		UserName: st.userName,
+		Typing:   typing,
+	}
+	if typing {
+		ev.ExpiresInMs = typingTimeout.Milliseconds()
+	}
+	// Coalesced: a slow session only needs the latest typing state per user.
+	BroadcastToRoomCoalesced(st.roomID, "typing:"+st.roomID+":"+st.userID,
+		NewEnvelopeMessage(TypingRoute, Success(ev)), st.sess.ID())
+}
@@ -2,8 +2,10 @@ package main
 
 import (
 	"log"
+	"os"
 
 	"musick-server/internal/app"
+	"musick-server/internal/app/services"
 
 	"github.com/joho/godotenv"
 )
@@ -16,6 +18,11 @@ func main() {
 		log.Println("Warning: .env file not found, using system environment variables")
 	}
 
+	// Select storage backend (supabase by default, memory for local runs/CI)
+	if err := services.InitStore(os.Getenv("STORE_BACKEND")); err != nil {
+		log.Fatalf("storage init failed: %v", err)
+	}
+
 	server := app.New()
 	if err := server.Run(listenAddr); err != nil {
 		log.Fatalf("server stopped: %v", err)